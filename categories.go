@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// What kind of event a showing is, beyond a regular screening of a film.
+type eventCategory string
+
+const (
+	SeniorClub      eventCategory = "senior"
+	Kids            eventCategory = "kids"
+	FilmClub        eventCategory = "dkf"
+	ForeignLanguage eventCategory = "foreign-language"
+	LiveBroadcast   eventCategory = "live"
+	Marathon        eventCategory = "marathon"
+	Festival        eventCategory = "festival"
+	Accessible      eventCategory = "accessible"
+	// concerts, lectures and such, which aren't films at all
+	Event eventCategory = "event"
+)
+
+// in the order their sections are listed in
+var eventCategories = []eventCategory{
+	LiveBroadcast, Event, Marathon, Festival, FilmClub,
+	Kids, SeniorClub, Accessible, ForeignLanguage,
+}
+
+var eventCategoryHeadings = map[eventCategory]string{
+	SeniorClub:      "SENIOR CLUB",
+	Kids:            "FOR KIDS",
+	FilmClub:        "FILM CLUB",
+	ForeignLanguage: "FOREIGN LANGUAGE",
+	LiveBroadcast:   "LIVE BROADCASTS",
+	Event:           "OTHER EVENTS",
+	Marathon:        "MARATHONS",
+	Festival:        "FESTIVALS",
+	Accessible:      "ACCESSIBLE",
+}
+
+// the ones which used to be left out of the summary altogether
+var defaultHiddenCategories = []eventCategory{SeniorClub, Kids, ForeignLanguage, Accessible}
+
+type categoryRule struct {
+	category eventCategory
+	// matched against the upper case title
+	regex *regexp.Regexp
+	// whether the marker is cut out of the title, so that the showing is
+	// listed under the film itself; the ones that are events of their own
+	// keep their titles as they are
+	removed bool
+}
+
+var categoryRules = []categoryRule{
+	{SeniorClub, regexp.MustCompile(`KLUB SENIORA`), true},
+	{Kids, regexp.MustCompile(`(?:KINO |PORANEK |SEANS )?DLA DZIECI`), true},
+	{FilmClub, regexp.MustCompile(`DKF(?: KROPKA| PEŁNA SALA)?`), true},
+	{ForeignLanguage, regexp.MustCompile(`(?:UKRAINIAN|UKRAIŃSKI)(?: DUBBING| VERSION| WERSJA)?`), true},
+	{Accessible, regexp.MustCompile(`(?:SEANS |POKAZ )?DLA OSÓB(?: NIESŁYSZĄCYCH| NIEWIDOMYCH| NIEWIDZĄCYCH| SŁABOSŁYSZĄCYCH| Z NIEPEŁNOSPRAWNOŚCIAMI| Z NIEPEŁNOSPRAWNOŚCIĄ)?|AUDIODESKRYPCJ[AĄIE]`), true},
+	{LiveBroadcast, regexp.MustCompile(`\b(?:MET OPERA|METROPOLITAN OPERA|THE MET|NT LIVE|NATIONAL THEATRE LIVE|ROYAL OPERA HOUSE|ROYAL BALLET|BOLSHOI|BALET BOLSZOJ|RETRANSMISJA|TRANSMISJA)\b`), false},
+	{Event, regexp.MustCompile(`\b(?:KONCERT|RECITAL|WYKŁAD|PRELEKCJA|SPOTKANIE AUTORSKIE|STAND-?UP)`), false},
+	{Marathon, regexp.MustCompile(`\bMARATON`), false},
+	{Festival, regexp.MustCompile(`\b(?:FESTIWAL|FESTIVAL|PRZEGLĄD FILM)`), false},
+}
+
+// Genres the movie dbs and cinemas give to what isn't a film, e.g. concerts.
+var eventGenres = []string{"koncert", "opera", "balet", "spektakl", "teatr", "wydarzenie", "stand-up"}
+
+// The categories the upper case title is marked with, and the title with
+// the markers of the ones that aren't events of their own cut out.
+func classifyTitle(title string) ([]eventCategory, string) {
+	categories := []eventCategory{}
+	for _, rule := range categoryRules {
+		if !rule.regex.MatchString(title) {
+			continue
+		}
+		categories = append(categories, rule.category)
+		if rule.removed {
+			title = rule.regex.ReplaceAllString(title, " ")
+		}
+	}
+	return categories, title
+}
+
+// Whether a movie is an event rather than a film: either all of its
+// showings are marked as events, it's got an event genre, or a movie db
+// lists it as something other than a film.
+func isEvent(movieInfoPtr *movieInfo) bool {
+	if movieInfoPtr.metadata.kind != "" {
+		return true
+	}
+
+	if slices.ContainsFunc(movieInfoPtr.metadata.genres, func(genre string) bool {
+		return slices.Contains(eventGenres, strings.ToLower(genre))
+	}) {
+		return true
+	}
+
+	return len(movieInfoPtr.showings) > 0 &&
+		!slices.ContainsFunc(movieInfoPtr.showings, func(s showing) bool {
+			return !slices.Contains(s.categories, LiveBroadcast) && !slices.Contains(s.categories, Event)
+		})
+}
+
+// Takes the events out of the periods. The ones found by their genre get
+// their showings marked as events too, so that they can be filtered as such.
+func extractEvents(periodToMovie map[timePeriod]map[string]*movieInfo) map[string]*movieInfo {
+	titleToEvent := map[string]*movieInfo{}
+	for _, movieMap := range periodToMovie {
+		for title, movieInfoPtr := range movieMap {
+			if !isEvent(movieInfoPtr) {
+				continue
+			}
+
+			for i, showing := range movieInfoPtr.showings {
+				if !slices.Contains(showing.categories, LiveBroadcast) && !slices.Contains(showing.categories, Event) {
+					movieInfoPtr.showings[i].categories = append(slices.Clone(showing.categories), Event)
+				}
+			}
+			titleToEvent[title] = movieInfoPtr
+			delete(movieMap, title)
+		}
+	}
+	return titleToEvent
+}
+
+// One line per showing, without a link, since they're not in the movie dbs.
+func writeEvents(sb *strings.Builder, titleToEvent map[string]*movieInfo) {
+	for _, title := range sortedTitles(titleToEvent) {
+		sb.WriteString(fmt.Sprintf(`## %s  \n`, strings.Replace(title, "\"", "\\\"", -1)))
+		for _, showing := range titleToEvent[title].showings {
+			showingLine := fmt.Sprintf(`[%s](%s)  [%s](%s)%s`,
+				showing.cinema, showing.cinema.info().Website,
+				formatShowingTime(showing.time), showing.url, formatEnd(showing))
+			if details := showing.details(); details != "" {
+				showingLine += fmt.Sprintf(`  *%s*`, details)
+			}
+			sb.WriteString(showingLine + `  \n`)
+		}
+		sb.WriteString(`  \n`)
+	}
+}
+
+// For the db, e.g. "kids,dkf".
+func formatEventCategories(categories []eventCategory) string {
+	names := []string{}
+	for _, category := range categories {
+		names = append(names, string(category))
+	}
+	return strings.Join(names, ",")
+}
+
+func parseEventCategoryList(list string) []eventCategory {
+	categories := []eventCategory{}
+	for name := range strings.SplitSeq(list, ",") {
+		if name != "" {
+			categories = append(categories, eventCategory(name))
+		}
+	}
+	return categories
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestIsEvent(t *testing.T) {
+	film := showing{cinema: "Kijow"}
+	live := showing{cinema: "Kijow", categories: []eventCategory{LiveBroadcast}}
+
+	tests := []struct {
+		name     string
+		metadata movieMetadata
+		showings []showing
+		want     bool
+	}{
+		{"film", movieMetadata{genres: []string{"Dramat"}}, []showing{film}, false},
+		{"event genre", movieMetadata{genres: []string{"Dramat", "Koncert"}}, []showing{film}, true},
+		{"listed as a TV show", movieMetadata{kind: "tvshow"}, []showing{film}, true},
+		{"all showings live", movieMetadata{}, []showing{live, live}, true},
+		{"some showings live", movieMetadata{}, []showing{live, film}, false},
+		{"no showings", movieMetadata{}, nil, false},
+	}
+
+	for _, test := range tests {
+		movieInfoPtr := &movieInfo{metadata: test.metadata, showings: test.showings}
+		if got := isEvent(movieInfoPtr); got != test.want {
+			t.Errorf("%s: isEvent = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type changeKind int
+
+const (
+	Added changeKind = iota
+	Cancelled
+	Rescheduled
+)
+
+type showingChange struct {
+	kind changeKind
+	// the new one, or the cancelled one
+	showing showing
+	// only for rescheduled ones
+	previousTime time.Time
+}
+
+type showingKey struct {
+	title  string
+	cinema cinema
+	time   int64
+}
+
+// Diffs the showings of the titles known from the previous run against it,
+// only for cinemas which responded both times, so that an outage doesn't
+// read as everything being cancelled and then added again. An added showing
+// and a cancelled one sharing a booking URL are taken to be rescheduled.
+func diffShowings(titleToShowings map[string][]showing, previousTitleToShowings map[string][]showing, cinemaToReceived map[cinema]bool) map[string][]showingChange {
+	previousCinemas := map[cinema]bool{}
+	for _, showings := range previousTitleToShowings {
+		for _, showing := range showings {
+			previousCinemas[showing.cinema] = true
+		}
+	}
+	isCompared := func(cinema cinema) bool {
+		return cinemaToReceived[cinema] && previousCinemas[cinema]
+	}
+
+	now := time.Now()
+	titleToChanges := map[string][]showingChange{}
+	for title, showings := range titleToShowings {
+		previousShowings, ok := previousTitleToShowings[title]
+		if !ok {
+			continue
+		}
+
+		keys := map[showingKey]bool{}
+		for _, showing := range showings {
+			keys[showing.key(title)] = true
+		}
+		previousKeys := map[showingKey]bool{}
+		for _, showing := range previousShowings {
+			previousKeys[showing.key(title)] = true
+		}
+
+		cancelled := []showing{}
+		for _, showing := range previousShowings {
+			if isCompared(showing.cinema) && showing.time.After(now) && !keys[showing.key(title)] {
+				cancelled = append(cancelled, showing)
+			}
+		}
+
+		changes := []showingChange{}
+		for _, added := range showings {
+			if !isCompared(added.cinema) || previousKeys[added.key(title)] {
+				continue
+			}
+
+			cancelledIndex := slices.IndexFunc(cancelled, func(c showing) bool {
+				return c.url != "" && c.url == added.url && c.cinema == added.cinema
+			})
+			if cancelledIndex == -1 {
+				changes = append(changes, showingChange{Added, added, time.Time{}})
+			} else {
+				changes = append(changes,
+					showingChange{Rescheduled, added, cancelled[cancelledIndex].time})
+				cancelled = slices.Delete(cancelled, cancelledIndex, cancelledIndex+1)
+			}
+		}
+		for _, showing := range cancelled {
+			changes = append(changes, showingChange{Cancelled, showing, time.Time{}})
+		}
+
+		if len(changes) > 0 {
+			slices.SortFunc(changes, func(a, b showingChange) int {
+				return a.showing.time.Compare(b.showing.time)
+			})
+			titleToChanges[title] = changes
+		}
+	}
+
+	return titleToChanges
+}
+
+func (s showing) key(title string) showingKey {
+	return showingKey{title, s.cinema, s.time.Unix()}
+}
+
+// Must be called before the current run is recorded.
+func loadPreviousShowings(dbPtr *sql.DB) map[string][]showing {
+	sqlSelect := `
+		SELECT title, cinema, starts_at, url, categories, combined_title
+			FROM run_showings
+			WHERE run_id = (SELECT MAX(id) FROM runs WHERE city = ?);
+	`
+	rows, err := dbPtr.Query(sqlSelect, currentCity.Id)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	titleToShowings := map[string][]showing{}
+	for rows.Next() {
+		var title, cinemaStr, startsAtStr, url, categories, combinedTitle string
+		err := rows.Scan(&title, &cinemaStr, &startsAtStr, &url, &categories, &combinedTitle)
+		if err != nil {
+			panic(err)
+		}
+		startsAt, err := time.Parse(time.RFC3339, startsAtStr)
+		if err != nil {
+			panic(err)
+		}
+
+		titleToShowings[title] = append(titleToShowings[title],
+			showing{
+				cinema:        cinema(cinemaStr),
+				time:          startsAt.In(warsawLocation),
+				url:           url,
+				categories:    parseEventCategoryList(categories),
+				combinedTitle: combinedTitle,
+			})
+	}
+
+	return titleToShowings
+}
+
+// Only the latest run's showings are kept, as that's all that's diffed.
+func recordRunShowings(runId int64, titleToShowings map[string][]showing, dbPtr *sql.DB) {
+	sqlInsert := `
+		INSERT INTO run_showings
+			(run_id, title, cinema, starts_at, url, categories, combined_title)
+			VALUES(?, ?, ?, ?, ?, ?, ?);
+	`
+	for title, showings := range titleToShowings {
+		for _, showing := range showings {
+			_, err := dbPtr.Exec(sqlInsert, runId, title, string(showing.cinema),
+				showing.time.Format(time.RFC3339), showing.url, formatEventCategories(showing.categories),
+				showing.combinedTitle)
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	sqlDelete := `
+		DELETE FROM run_showings
+			WHERE run_id IN (SELECT id FROM runs WHERE city = ? AND id < ?);
+	`
+	_, err := dbPtr.Exec(sqlDelete, currentCity.Id, runId)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func writeChanges(sb *strings.Builder, titleToChanges map[string][]showingChange, titleToMovie map[string]*movieInfo) {
+	for _, title := range sortedTitles(titleToChanges) {
+		titleFormatted := strings.Replace(title, "\"", "\\\"", -1)
+		// e.g. a movie whose showings were all cancelled, or whose remaining
+		// ones are filtered out, isn't listed anywhere else to link to
+		movieUrl := ""
+		if movieInfoPtr, ok := titleToMovie[title]; ok {
+			movieUrl = movieLink(movieInfoPtr)
+		}
+		if movieUrl != "" {
+			sb.WriteString(fmt.Sprintf(`## [%s](%s)  \n`, titleFormatted, movieUrl))
+		} else {
+			sb.WriteString(fmt.Sprintf(`## %s  \n`, titleFormatted))
+		}
+
+		for _, change := range titleToChanges[title] {
+			showing := change.showing
+			cinemaLink := fmt.Sprintf(`[%s](%s)`, showing.cinema, showing.cinema.info().Website)
+			timeLink := fmt.Sprintf(`[%s](%s)`, formatShowingTime(showing.time), showing.url)
+
+			var changeLine string
+			switch change.kind {
+			case Added:
+				changeLine = fmt.Sprintf(`**+** %s  %s  \n`, cinemaLink, timeLink)
+			case Cancelled:
+				changeLine = fmt.Sprintf(`**−** %s  ~~%s~~  \n`,
+					cinemaLink, formatShowingTime(showing.time))
+			case Rescheduled:
+				changeLine = fmt.Sprintf(`**→** %s  ~~%s~~ %s  \n`,
+					cinemaLink, formatShowingTime(change.previousTime), timeLink)
+			}
+			sb.WriteString(changeLine)
+		}
+
+		sb.WriteString(`  \n`)
+	}
+}
+
+// e.g. "24/10 20:00"
+func formatShowingTime(t time.Time) string {
+	return fmt.Sprintf("%02d/%02d %02d:%02d", t.Day(), t.Month(), t.Hour(), t.Minute())
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Used unless another registry file is given with --cinemas-config.
+//
+//go:embed cinemas.json
+var defaultCinemasJson []byte
+
+// A cinema's ID, as used in the registry, the scraper definitions and the db.
+type cinema string
+
+type cityInfo struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type cinemaInfo struct {
+	Id        cinema  `json:"id"`
+	Name      string  `json:"name"`
+	City      string  `json:"city"`
+	Address   string  `json:"address"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Website   string  `json:"website"`
+	// "scrape", "multikino" or "cinema-city"
+	Source string `json:"source"`
+	// the cinema's ID within its chain's API
+	ApiId   string `json:"apiId,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+var fetchersBySource = map[string]func(cinema, chan result){
+	"multikino":   fetchMultikino,
+	"cinema-city": fetchCCity,
+}
+
+type registry struct {
+	Cities  []cityInfo   `json:"cities"`
+	Cinemas []cinemaInfo `json:"cinemas"`
+}
+
+const defaultCity = "krakow"
+
+var cities []cityInfo
+
+// The one the showings are gathered for, set up by setupCinemas.
+var currentCity cityInfo
+
+// All the known cinemas, enabled or not, in the registry's order.
+var cinemaRegistry []cinemaInfo
+
+var cinemaToInfo = map[cinema]*cinemaInfo{}
+
+func (c cinema) String() string {
+	if info, ok := cinemaToInfo[c]; ok && info.Name != "" {
+		return info.Name
+	}
+	return string(c)
+}
+
+func (c cinema) info() cinemaInfo {
+	if info, ok := cinemaToInfo[c]; ok {
+		return *info
+	}
+	return cinemaInfo{Id: c}
+}
+
+// The enabled cinemas of the current city.
+func enabledCinemas() []cinema {
+	cinemas := []cinema{}
+	for _, info := range cinemaRegistry {
+		if info.Enabled && info.City == currentCity.Id {
+			cinemas = append(cinemas, info.Id)
+		}
+	}
+	return cinemas
+}
+
+// Loads the registry and the scraper definitions (the built-in ones for empty
+// paths), setting up the city's enabled cinemas to be scraped and fetched.
+func setupCinemas(registryPath string, scrapersPath string, city string) error {
+	registryJson := defaultCinemasJson
+	if registryPath != "" {
+		var err error
+		if registryJson, err = os.ReadFile(registryPath); err != nil {
+			return err
+		}
+	}
+
+	registry, err := parseRegistry(registryJson)
+	if err != nil {
+		return err
+	}
+	setCinemaRegistry(registry)
+
+	cityIndex := slices.IndexFunc(cities, func(c cityInfo) bool {
+		return c.Id == city
+	})
+	if cityIndex == -1 {
+		return fmt.Errorf("unknown city %q", city)
+	}
+	currentCity = cities[cityIndex]
+
+	scrapersJson := defaultScrapeSitesJson
+	if scrapersPath != "" {
+		var err error
+		if scrapersJson, err = os.ReadFile(scrapersPath); err != nil {
+			return err
+		}
+	}
+
+	sites, err := parseScrapeSites(scrapersJson)
+	if err != nil {
+		return fmt.Errorf("scraper definitions: %w", err)
+	}
+
+	cinemaToSite := map[cinema]scrapeSite{}
+	for _, site := range sites {
+		cinemaToSite[site.cinema] = site
+	}
+
+	cinemasToScrape = []scrapeSite{}
+	cinemasToFetch = []fetchSite{}
+	for _, cinema := range enabledCinemas() {
+		info := cinema.info()
+		if info.Source == "scrape" {
+			site, ok := cinemaToSite[info.Id]
+			if !ok {
+				return fmt.Errorf("no scraper definition for %s", info.Id)
+			}
+			cinemasToScrape = append(cinemasToScrape, site)
+		} else if fetcher, ok := fetchersBySource[info.Source]; ok {
+			cinemasToFetch = append(cinemasToFetch, fetchSite{info.Id, fetcher})
+		} else {
+			return fmt.Errorf("%s: unknown source %q", info.Id, info.Source)
+		}
+	}
+
+	return nil
+}
+
+func parseRegistry(registryJson []byte) (registry, error) {
+	var registry registry
+	if err := json.Unmarshal(registryJson, &registry); err != nil {
+		return registry, fmt.Errorf("cinema registry: %w", err)
+	}
+	return registry, nil
+}
+
+func setCinemaRegistry(registry registry) {
+	cities = registry.Cities
+	cinemaRegistry = registry.Cinemas
+	cinemaToInfo = map[cinema]*cinemaInfo{}
+	for i := range cinemaRegistry {
+		cinemaToInfo[cinemaRegistry[i].Id] = &cinemaRegistry[i]
+	}
+}
+
+const cinemasUsage = "usage: kino cinemas list|discover|enable|disable [flags] [cinema name]"
+
+// Manages a registry file, which can then be passed with --cinemas-config:
+// listing its cinemas, adding the chains' locations from their APIs, and
+// enabling or disabling cinemas picked by name. The changed registry goes
+// to stdout, unless a file is given with --out.
+func cinemasCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, cinemasUsage)
+		return 2
+	}
+	subcommand := args[0]
+
+	flags := flag.NewFlagSet("cinemas "+subcommand, flag.ExitOnError)
+	registryFlagPtr := flags.String("cinemas-config", "", "Path to the cinema registry to start from, the built-in one if not given or if it doesn't exist yet.")
+	outFlagPtr := flags.String("out", "", "Path to write the changed registry to, stdout if not given.")
+	cityFlagPtr := flags.String("city", "", "Only list the cinemas of the city with this ID.")
+	flags.Parse(args[1:])
+
+	registryJson := defaultCinemasJson
+	if *registryFlagPtr != "" {
+		var err error
+		registryJson, err = os.ReadFile(*registryFlagPtr)
+		if errors.Is(err, fs.ErrNotExist) {
+			registryJson = defaultCinemasJson
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	registry, err := parseRegistry(registryJson)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch subcommand {
+	case "list":
+		listCinemas(registry, *cityFlagPtr)
+		return 0
+
+	case "discover":
+		sourceToCinemas, err := discoverCinemas()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		added := mergeDiscoveredCinemas(&registry, sourceToCinemas)
+		fmt.Fprintf(os.Stderr, "%d cinemas added (disabled), enable them with 'kino cinemas enable <name>'\n", added)
+
+	case "enable", "disable":
+		info, err := findCinemaByName(registry.Cinemas, strings.Join(flags.Args(), " "))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		info.Enabled = subcommand == "enable"
+		fmt.Fprintf(os.Stderr, "%s (%s) %sd\n", info.Name, info.Id, subcommand)
+
+	default:
+		fmt.Fprintln(os.Stderr, cinemasUsage)
+		return 2
+	}
+
+	if err := writeRegistry(*outFlagPtr, registry); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func listCinemas(registry registry, city string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tCITY\tSOURCE\tENABLED\tADDRESS")
+	for _, info := range registry.Cinemas {
+		if city != "" && info.City != city {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\n",
+			info.Id, info.Name, info.City, info.Source, info.Enabled, info.Address)
+	}
+	w.Flush()
+}
+
+// An exact match of the ID or name wins, otherwise the name has to contain
+// the given one, ignoring case and diacritics, for exactly one cinema.
+func findCinemaByName(cinemas []cinemaInfo, name string) (*cinemaInfo, error) {
+	normalize := func(s string) string {
+		return strings.ToLower(foldDiacritics(strings.TrimSpace(s)))
+	}
+	normalizedName := normalize(name)
+	if normalizedName == "" {
+		return nil, errors.New(cinemasUsage)
+	}
+
+	matches := []*cinemaInfo{}
+	for i := range cinemas {
+		info := &cinemas[i]
+		if normalize(string(info.Id)) == normalizedName || normalize(info.Name) == normalizedName {
+			return info, nil
+		}
+		if strings.Contains(normalize(info.Name), normalizedName) {
+			matches = append(matches, info)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no cinema matches %q", name)
+	case 1:
+		return matches[0], nil
+	default:
+		names := []string{}
+		for _, match := range matches {
+			names = append(names, match.Name)
+		}
+		return nil, fmt.Errorf("%q matches several cinemas: %s", name, strings.Join(names, ", "))
+	}
+}
+
+// To stdout if no path is given, so that the built-in registry's source
+// isn't overwritten by accident when run from the repository.
+func writeRegistry(path string, registry registry) error {
+	registryJson, err := json.MarshalIndent(registry, "", "\t")
+	if err != nil {
+		return err
+	}
+	registryJson = append(registryJson, '\n')
+
+	if path == "" {
+		_, err = os.Stdout.Write(registryJson)
+		return err
+	}
+	return os.WriteFile(path, registryJson, 0644)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// e.g. "MARATON GWIEZDNYCH WOJEN: ..." or "PODWÓJNY SEANS: ...", followed
+// by the films
+var marathonPrefixRegex = regexp.MustCompile(`^\s*(?:MARATON|PODWÓJNY SEANS|DOUBLE FEATURE)[^:]*:\s*`)
+
+// between the films of a double feature, and a marathon's, which are
+// mostly listed with commas; slashes and bars are left alone, since they
+// separate a title's translations and its versions (e.g. "BLADE RUNNER | 4K")
+var combinedSeparatorRegex = regexp.MustCompile(`\s+\+\s+`)
+var marathonSeparatorRegex = regexp.MustCompile(`\s+\+\s+|\s*;\s*|\s*,\s+`)
+
+// single films whose titles happen to look like double features
+var notCombinedTitles = [...]string{
+	"ROMEO + JULIA",
+}
+
+// The films of a double feature ("A + B") or a marathon ("MARATON: A, B")
+// given its upper case title, none if it isn't one. Marathons of a single
+// series, e.g. "MARATON: WŁADCA PIERŚCIENI", aren't split, and neither is
+// anything else without a marathon's prefix but with a plus.
+func splitCombinedTitle(title string) []string {
+	if slices.ContainsFunc(notCombinedTitles[:], func(notCombined string) bool {
+		return strings.Contains(title, notCombined)
+	}) {
+		return nil
+	}
+
+	separatorRegex := combinedSeparatorRegex
+	if match := marathonPrefixRegex.FindString(title); match != "" {
+		title = title[len(match):]
+		separatorRegex = marathonSeparatorRegex
+	}
+
+	components := []string{}
+	for _, component := range separatorRegex.Split(title, -1) {
+		if component = strings.TrimSpace(component); component != "" {
+			components = append(components, component)
+		}
+	}
+
+	if len(components) < 2 {
+		return nil
+	}
+	return components
+}
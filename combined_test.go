@@ -0,0 +1,42 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitCombinedTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{"OBCY + OBCY: DECYDUJĄCE STARCIE", []string{"OBCY", "OBCY: DECYDUJĄCE STARCIE"}},
+		{
+			"MARATON GROZY: NOSFERATU, OBCY, COŚ",
+			[]string{"NOSFERATU", "OBCY", "COŚ"},
+		},
+		{
+			"MARATON GWIEZDNYCH WOJEN: NOWA NADZIEJA; IMPERIUM KONTRATAKUJE + POWRÓT JEDI",
+			[]string{"NOWA NADZIEJA", "IMPERIUM KONTRATAKUJE", "POWRÓT JEDI"},
+		},
+		{"PODWÓJNY SEANS: DIUNA, DIUNA: CZĘŚĆ DRUGA", []string{"DIUNA", "DIUNA: CZĘŚĆ DRUGA"}},
+
+		// single films
+		{"DIUNA: CZĘŚĆ DRUGA", nil},
+		{"ANATOMIA UPADKU / ANATOMIE D'UNE CHUTE", nil},
+		{"BLADE RUNNER | 4K", nil},
+		{"DZIEŃ ŚWIRA; WERSJA REŻYSERSKA", nil},
+		{"PIĘKNY UMYSŁ, 2001", nil},
+		{"AC/DC: LET THERE BE ROCK", nil},
+		{"ROMEO + JULIA", nil},
+		{"MARATON: WŁADCA PIERŚCIENI", nil},
+		{"MARATON: ANATOMIA UPADKU / ANATOMIE D'UNE CHUTE", nil},
+		{"MARATON:", nil},
+	}
+
+	for _, test := range tests {
+		if got := splitCombinedTitle(test.title); !slices.Equal(got, test.want) {
+			t.Errorf("splitCombinedTitle(%q) = %q, want %q", test.title, got, test.want)
+		}
+	}
+}
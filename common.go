@@ -1,106 +1,194 @@
 package main
 
 import (
+	"fmt"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
 	"time"
+	_ "time/tzdata"
 )
 
-//go:generate stringer -type=cinema
-type cinema int
+type seatAvailability int
 
 const (
-	Agrafka cinema = iota
-	CCityBonarka
-	CCityKazimierz
-	CCityZakopianka
-	Kijow
-	Kika
-	Mikro
-	PodBaranami
-	Multikino
-	Paradox
-	Sfinks
-	CINEMA_COUNT
+	// most sources don't say
+	AvailabilityUnknown seatAvailability = iota
+	Available
+	SellingFast
+	SoldOut
 )
 
+var seatAvailabilityNames = map[seatAvailability]string{
+	SellingFast: "ostatnie miejsca",
+	SoldOut:     "wyprzedane",
+}
+
 type showing struct {
 	cinema cinema
 	time   time.Time
 	url    string
+	// e.g. "IMAX", "napisy", in the order they're displayed in
+	attributes   []string
+	screen       string
+	availability seatAvailability
+	categories   []eventCategory
+	// the double feature or marathon it's part of, when listed under its films
+	combinedTitle string
+	// estimated from the film's length, zero if it isn't known
+	end time.Time
+}
+
+// e.g. "Sala 5 · IMAX · napisy · wyprzedane", with any unknown parts left out
+func (s showing) details() string {
+	parts := []string{}
+	if s.screen != "" {
+		parts = append(parts, s.screen)
+	}
+	parts = append(parts, s.attributes...)
+	if name, ok := seatAvailabilityNames[s.availability]; ok {
+		parts = append(parts, name)
+	}
+	if s.combinedTitle != "" {
+		parts = append(parts, "w ramach "+s.combinedTitle)
+	}
+	return strings.Join(parts, " · ")
 }
 
 type result struct {
 	cinema          cinema
 	titleToShowings map[string][]showing
+	// whatever the cinema knows about its films, keyed like the showings
+	titleToMetadata map[string]movieMetadata
+	anomalies       []anomaly
 }
 
 var timeRegex = regexp.MustCompile(`^(([0-1]?[0-9])|(2[0-3]))(:[0-5][0-9])+$`)
 
-var websites = map[cinema]string{
-	Agrafka:         "https://bilety.kinoagrafka.pl",
-	CCityBonarka:    "https://www.cinema-city.pl/kina/bonarka/1090#/buy-tickets-by-cinema?in-cinema=1090",
-	CCityKazimierz:  "https://www.cinema-city.pl/kina/kazimierz/1076#/buy-tickets-by-cinema?in-cinema=1076",
-	CCityZakopianka: "https://www.cinema-city.pl/kina/zakopianka/1064#/buy-tickets-by-cinema?in-cinema=1064",
-	Kijow:           "https://kupbilet.kijow.pl/MSI/mvc/pl?sort=Flow",
-	Kika:            "https://bilety.kinokika.pl",
-	Mikro:           "https://kinomikro.pl/repertoire/?view=all",
-	Multikino:       "https://www.multikino.pl/repertuar/krakow/teraz-gramy",
-	PodBaranami:     "https://www.kinopodbaranami.pl/repertuar.php",
-	Paradox:         "https://kinoparadox.pl/repertuar/",
-	Sfinks:          "https://kinosfinks.okn.edu.pl/wydarzenia-szukaj-strona-1.html",
+// all the cinemas are in Poland, regardless of where this runs
+var warsawLocation = mustLoadLocation("Europe/Warsaw")
+
+type dateOrder int
+
+const (
+	// e.g. "sobota 18 października 19:30" or "18.10.2025 19:30"
+	DayMonthYear dateOrder = iota
+	// e.g. "2025-10-18T19:30:00" or "'2025-10-18' 19:30"
+	YearMonthDay
+)
+
+// how far in the past a date without a year may be before it's assumed
+// to be from the next year instead
+const yearlessDateGrace = 7 * 24 * time.Hour
+
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return location
 }
 
-func processDateTimeString(rawDateTime string, cinema cinema) time.Time {
+// Expects the date parts in the given order (with the year optional and
+// the month either numeric or a polish name), along with an "hh:mm" time,
+// ignoring any other words like weekdays. Anything else is an error.
+func parseShowingTime(rawDateTime string, order dateOrder) (time.Time, error) {
 	dateTimeWords := strings.FieldsFunc(
 		rawDateTime,
 		func(r rune) bool {
-			return slices.Contains([]rune{' ', '\n', '\t', 'T', '-', '.', '/', '_', '\'', ','}, r)
+			return slices.Contains([]rune{' ', '\n', '\t', 'T', '-', '.', '/', '_', '\'', ',', '"'}, r)
 		})
 
-	var (
-		day, year, hour, minute int
-		month                   time.Month
-	)
-
-	for _, dateTime := range dateTimeWords {
-		// don't care for month-day or any other abomination of the sort
-		if dateTimeInt, err := strconv.Atoi(dateTime); err == nil {
-			if day == 0 && dateTimeInt <= 31 && !(year != 0 && month == 0) {
-				day = dateTimeInt
-			} else if month == 0 && dateTimeInt <= 31 {
-				month = time.Month(dateTimeInt)
-			} else if year == 0 && dateTimeInt > 2000 {
-				year = dateTimeInt
+	if order == YearMonthDay {
+		// APIs might include the offset, in which case it's unambiguous
+		if dateTime, err := time.Parse(time.RFC3339, rawDateTime); err == nil {
+			return dateTime.In(warsawLocation), nil
+		}
+	}
+
+	var dateParts []int
+	var month time.Month
+	hour, minute := -1, -1
+
+	for _, word := range dateTimeWords {
+		if number, err := strconv.Atoi(word); err == nil {
+			dateParts = append(dateParts, number)
+		} else if timeRegex.MatchString(word) {
+			if hour != -1 {
+				return time.Time{}, fmt.Errorf("more than one time in %q", rawDateTime)
 			}
-		} else if day != 0 && month == 0 {
-			month = mapMonth(dateTime)
-		} else if timeRegex.MatchString(dateTime) {
-			hourMinuteSecond := strings.Split(dateTime, ":")
+			hourMinuteSecond := strings.Split(word, ":")
 			hour, _ = strconv.Atoi(hourMinuteSecond[0])
 			minute, _ = strconv.Atoi(hourMinuteSecond[1])
+		} else if namedMonth := mapMonth(word); namedMonth != 0 {
+			if month != 0 {
+				return time.Time{}, fmt.Errorf("more than one month in %q", rawDateTime)
+			}
+			month = namedMonth
+			// stands in for the numeric month, right after the day
+			dateParts = append(dateParts, int(month))
 		}
 	}
 
+	if hour == -1 {
+		return time.Time{}, fmt.Errorf("no time in %q", rawDateTime)
+	}
+
+	var day, year int
+	switch {
+	case order == DayMonthYear && len(dateParts) == 2:
+		day, month = dateParts[0], time.Month(dateParts[1])
+	case order == DayMonthYear && len(dateParts) == 3:
+		day, month, year = dateParts[0], time.Month(dateParts[1]), dateParts[2]
+	case order == YearMonthDay && len(dateParts) == 3:
+		year, month, day = dateParts[0], time.Month(dateParts[1]), dateParts[2]
+	default:
+		return time.Time{}, fmt.Errorf("unexpected date parts %v in %q", dateParts, rawDateTime)
+	}
+
+	if year != 0 && year < 2000 {
+		return time.Time{}, fmt.Errorf("implausible year %d in %q", year, rawDateTime)
+	}
+
 	if year == 0 {
-		year = time.Now().Year()
-		// just assume next year, if it's an earlier month
-		if month < time.Now().Month() {
-			year++
-		}
+		year = inferYear(month, day, hour, minute, time.Now())
 	}
 
-	location := time.Now().Location()
+	dateTime := time.Date(year, month, day, hour, minute, 0, 0, warsawLocation)
+	// time.Date normalizes e.g. February 31st into March instead of failing
+	if dateTime.Month() != month || dateTime.Day() != day {
+		return time.Time{}, fmt.Errorf("invalid date in %q", rawDateTime)
+	}
 
-	return time.Date(year, month, day, hour, minute, 0, 0, location)
+	return dateTime, nil
 }
 
+// The earliest year around now in which the date isn't too far in the past,
+// so that in December the January showings get next year.
+func inferYear(month time.Month, day int, hour int, minute int, now time.Time) int {
+	now = now.In(warsawLocation)
+
+	for year := now.Year() - 1; year < now.Year()+1; year++ {
+		candidate := time.Date(year, month, day, hour, minute, 0, 0, warsawLocation)
+		if candidate.After(now.Add(-yearlessDateGrace)) {
+			return year
+		}
+	}
+
+	return now.Year() + 1
+}
+
+// 0 if it's not a (polish, possibly inflected) month name
 func mapMonth(monthStr string) time.Month {
 	var month time.Month
 
-	switch strings.ToLower(monthStr[:3]) {
+	monthRunes := []rune(strings.ToLower(monthStr))
+	if len(monthRunes) < 3 {
+		return month
+	}
+
+	switch string(monthRunes[:3]) {
 	case "sty":
 		month = time.January
 	case "lut":
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseShowingTime(t *testing.T) {
+	tests := []struct {
+		raw   string
+		order dateOrder
+		// in UTC, so that the offset in Warsaw is checked as well
+		want    time.Time
+		wantErr bool
+	}{
+		{raw: "24.10.2026 17:30", order: DayMonthYear, want: utc(2026, 10, 24, 15, 30)},
+		{raw: "24/10/2026 17:30", order: DayMonthYear, want: utc(2026, 10, 24, 15, 30)},
+		{raw: "Sobota, 24 października 2026, 17:30", order: DayMonthYear, want: utc(2026, 10, 24, 15, 30)},
+		{raw: "2026-10-24 17:30", order: YearMonthDay, want: utc(2026, 10, 24, 15, 30)},
+		{raw: "2026-10-24T17:30:00", order: YearMonthDay, want: utc(2026, 10, 24, 15, 30)},
+		{raw: "2026-10-24T17:30:00+02:00", order: YearMonthDay, want: utc(2026, 10, 24, 15, 30)},
+		{raw: "2026-10-24T15:30:00Z", order: YearMonthDay, want: utc(2026, 10, 24, 15, 30)},
+		{raw: "31.12.2026 23:45", order: DayMonthYear, want: utc(2026, 12, 31, 22, 45)},
+		{raw: "2027-01-01 0:15", order: YearMonthDay, want: utc(2026, 12, 31, 23, 15)},
+
+		// around the DST transitions, on the last Sundays of March and October
+		{raw: "28.03.2026 20:00", order: DayMonthYear, want: utc(2026, 3, 28, 19, 0)},
+		{raw: "29.03.2026 20:00", order: DayMonthYear, want: utc(2026, 3, 29, 18, 0)},
+		{raw: "2026-03-29 01:30", order: YearMonthDay, want: utc(2026, 3, 29, 0, 30)},
+		{raw: "2026-03-29 03:30", order: YearMonthDay, want: utc(2026, 3, 29, 1, 30)},
+		{raw: "24.10.2026 20:00", order: DayMonthYear, want: utc(2026, 10, 24, 18, 0)},
+		{raw: "25.10.2026 20:00", order: DayMonthYear, want: utc(2026, 10, 25, 19, 0)},
+		{raw: "2026-10-25 03:30", order: YearMonthDay, want: utc(2026, 10, 25, 2, 30)},
+
+		{raw: "", order: DayMonthYear, wantErr: true},
+		{raw: "24.10.2026", order: DayMonthYear, wantErr: true},
+		{raw: "24.10.2026 24:00", order: DayMonthYear, wantErr: true},
+		{raw: "24.10.2026 17:30 20:00", order: DayMonthYear, wantErr: true},
+		{raw: "24 października listopada 17:30", order: DayMonthYear, wantErr: true},
+		{raw: "31.02.2026 17:30", order: DayMonthYear, wantErr: true},
+		{raw: "2026-02-29 17:30", order: YearMonthDay, wantErr: true},
+		{raw: "24.13.2026 17:30", order: DayMonthYear, wantErr: true},
+		{raw: "0.10.2026 17:30", order: DayMonthYear, wantErr: true},
+		{raw: "24.10.1999 17:30", order: DayMonthYear, wantErr: true},
+		{raw: "24 17:30", order: DayMonthYear, wantErr: true},
+		{raw: "10-24 17:30", order: YearMonthDay, wantErr: true},
+		{raw: "2026-10-24 17:30", order: DayMonthYear, wantErr: true},
+		{raw: "24.10.2026 17:30", order: YearMonthDay, wantErr: true},
+		{raw: "1.2.3.4 17:30", order: DayMonthYear, wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseShowingTime(test.raw, test.order)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseShowingTime(%q) = %v, want an error", test.raw, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseShowingTime(%q): %v", test.raw, err)
+			continue
+		}
+		if !got.Equal(test.want) || got.Location() != warsawLocation {
+			t.Errorf("parseShowingTime(%q) = %v, want %v in Warsaw", test.raw, got, test.want.In(warsawLocation))
+		}
+	}
+}
+
+func TestParseShowingTimeWithoutYear(t *testing.T) {
+	got, err := parseShowingTime("pt. 24.10 17:30", DayMonthYear)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantYear := inferYear(time.October, 24, 17, 30, time.Now())
+	want := time.Date(wantYear, time.October, 24, 17, 30, 0, 0, warsawLocation)
+	if !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestInferYear(t *testing.T) {
+	tests := []struct {
+		name  string
+		month time.Month
+		day   int
+		now   time.Time
+		want  int
+	}{
+		{"later this year", time.November, 5, warsaw(2026, 10, 18, 12, 0), 2026},
+		{"today", time.October, 18, warsaw(2026, 10, 18, 12, 0), 2026},
+		{"within the grace period", time.October, 12, warsaw(2026, 10, 18, 12, 0), 2026},
+		{"past the grace period", time.October, 10, warsaw(2026, 10, 18, 12, 0), 2027},
+		{"january in december", time.January, 3, warsaw(2026, 12, 20, 12, 0), 2027},
+		{"december in january", time.December, 30, warsaw(2027, 1, 2, 12, 0), 2026},
+		{"new year's eve in january", time.December, 31, warsaw(2027, 1, 10, 12, 0), 2027},
+		// already January in Warsaw, though still December in UTC
+		{"new year's night", time.January, 1, utc(2026, 12, 31, 23, 30), 2027},
+		{"leap day", time.February, 29, warsaw(2027, 10, 18, 12, 0), 2028},
+	}
+
+	for _, test := range tests {
+		if got := inferYear(test.month, test.day, 20, 0, test.now); got != test.want {
+			t.Errorf("%s: inferYear(%s %d, now %v) = %d, want %d",
+				test.name, test.month, test.day, test.now, got, test.want)
+		}
+	}
+}
+
+func FuzzParseShowingTime(f *testing.F) {
+	seeds := []string{
+		"24.10.2026 17:30",
+		"Sobota, 24 października 2026, 17:30",
+		"2026-10-24T17:30:00+02:00",
+		"2026-10-24 17:30",
+		"pt. 24.10 17:30",
+		"31.02.2026 17:30",
+		"",
+	}
+	for _, seed := range seeds {
+		f.Add(seed, int(DayMonthYear))
+		f.Add(seed, int(YearMonthDay))
+	}
+
+	f.Fuzz(func(t *testing.T, raw string, order int) {
+		dateTime, err := parseShowingTime(raw, dateOrder(order))
+		if err == nil && dateTime.Location() != warsawLocation {
+			t.Errorf("parseShowingTime(%q) = %v, not in Warsaw", raw, dateTime)
+		}
+	})
+}
+
+func utc(year int, month time.Month, day int, hour int, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func warsaw(year int, month time.Month, day int, hour int, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, warsawLocation)
+}
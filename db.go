@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Applied in order, once each; the index of the next migration to run is
+// kept in the database's user_version pragma.
+var migrations = [...]func(tx *sql.Tx) error{
+	execMigration(`
+	CREATE TABLE IF NOT EXISTS movies (
+		title TEXT NOT NULL PRIMARY KEY,
+		first_seen TEXT NOT NULL,
+		last_seen TEXT NOT NULL,
+		secondary_title TEXT,
+		ext_db_id TEXT
+	);
+	`),
+	execMigration(`
+	ALTER TABLE movies ADD COLUMN ext_db_confidence REAL;
+	`),
+	execMigration(`
+	CREATE TABLE lookup_cache (
+		provider TEXT NOT NULL,
+		query TEXT NOT NULL,
+		found INTEGER NOT NULL,
+		checked_at TEXT NOT NULL,
+		PRIMARY KEY (provider, query)
+	);
+	`),
+	regenerateFilmwebIds,
+	execMigration(`
+	ALTER TABLE movies ADD COLUMN year INTEGER;
+	ALTER TABLE movies ADD COLUMN duration INTEGER;
+	ALTER TABLE movies ADD COLUMN rating REAL;
+	ALTER TABLE movies ADD COLUMN director TEXT;
+	ALTER TABLE movies ADD COLUMN poster_url TEXT;
+	CREATE TABLE movie_genres (
+		title TEXT NOT NULL,
+		genre TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (title, genre)
+	);
+	CREATE TABLE movie_countries (
+		title TEXT NOT NULL,
+		country TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (title, country)
+	);
+	`),
+	execMigration(`
+	CREATE TABLE movie_ext_ids (
+		title TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		ext_id TEXT NOT NULL,
+		confidence REAL,
+		PRIMARY KEY (title, provider)
+	);
+	INSERT INTO movie_ext_ids
+		(title, provider, ext_id, confidence)
+		SELECT title, 'filmweb', ext_db_id, ext_db_confidence
+			FROM movies
+			WHERE ext_db_id IS NOT NULL AND ext_db_id != '';
+	ALTER TABLE movies DROP COLUMN ext_db_id;
+	ALTER TABLE movies DROP COLUMN ext_db_confidence;
+	`),
+	execMigration(`
+	CREATE TABLE runs (
+		id INTEGER PRIMARY KEY,
+		started_at TEXT NOT NULL
+	);
+	CREATE TABLE run_cinema_counts (
+		run_id INTEGER NOT NULL REFERENCES runs(id),
+		cinema TEXT NOT NULL,
+		showings INTEGER NOT NULL,
+		PRIMARY KEY (run_id, cinema)
+	);
+	CREATE TABLE run_anomalies (
+		run_id INTEGER NOT NULL REFERENCES runs(id),
+		cinema TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		detail TEXT NOT NULL
+	);
+	`),
+	execMigration(`
+	CREATE TABLE movie_sightings (
+		city TEXT NOT NULL,
+		title TEXT NOT NULL REFERENCES movies(title),
+		first_seen TEXT NOT NULL,
+		last_seen TEXT NOT NULL,
+		PRIMARY KEY (city, title)
+	);
+	INSERT INTO movie_sightings
+		(city, title, first_seen, last_seen)
+		SELECT 'krakow', title, first_seen, last_seen
+			FROM movies;
+	ALTER TABLE movies DROP COLUMN first_seen;
+	ALTER TABLE movies DROP COLUMN last_seen;
+	ALTER TABLE runs ADD COLUMN city TEXT NOT NULL DEFAULT 'krakow';
+	`),
+	execMigration(`
+	ALTER TABLE movies ADD COLUMN age_rating TEXT;
+	`),
+	execMigration(`
+	CREATE TABLE run_showings (
+		run_id INTEGER NOT NULL REFERENCES runs(id),
+		title TEXT NOT NULL,
+		cinema TEXT NOT NULL,
+		starts_at TEXT NOT NULL,
+		url TEXT NOT NULL
+	);
+	CREATE INDEX run_showings_run_id ON run_showings (run_id);
+	`),
+	execMigration(`
+	CREATE TABLE watchlist (
+		id INTEGER PRIMARY KEY,
+		title TEXT,
+		filmweb_id TEXT,
+		added_at TEXT NOT NULL,
+		CHECK ((title IS NULL) != (filmweb_id IS NULL))
+	);
+	`),
+	execMigration(`
+	CREATE TABLE watchlist_labeled (
+		id INTEGER PRIMARY KEY,
+		title TEXT,
+		filmweb_id TEXT,
+		added_at TEXT NOT NULL,
+		CHECK (title IS NOT NULL OR filmweb_id IS NOT NULL)
+	);
+	INSERT INTO watchlist_labeled SELECT * FROM watchlist;
+	DROP TABLE watchlist;
+	ALTER TABLE watchlist_labeled RENAME TO watchlist;
+	`),
+	execMigration(`
+	ALTER TABLE run_showings ADD COLUMN categories TEXT NOT NULL DEFAULT '';
+	`),
+	execMigration(`
+	ALTER TABLE movies ADD COLUMN kind TEXT;
+	`),
+	forgetUnsureMetadata,
+	execMigration(`
+	ALTER TABLE run_showings ADD COLUMN combined_title TEXT NOT NULL DEFAULT '';
+	`),
+}
+
+func execMigration(query string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+func openDb(path string) *sql.DB {
+	dbPtr, err := sql.Open("sqlite", path)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = dbPtr.Exec("PRAGMA journal_mode=WAL;")
+	if err != nil {
+		panic(err)
+	}
+	// TODO temporary solution for DB access
+	_, err = dbPtr.Exec("PRAGMA busy_timeout=50000;")
+	if err != nil {
+		panic(err)
+	}
+	dbPtr.SetMaxOpenConns(1)
+
+	migrateDb(dbPtr)
+
+	return dbPtr
+}
+
+func migrateDb(dbPtr *sql.DB) {
+	var version int
+	err := dbPtr.QueryRow("PRAGMA user_version;").Scan(&version)
+	if err != nil {
+		panic(err)
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := dbPtr.Begin()
+		if err != nil {
+			panic(err)
+		}
+
+		if err := migrations[version](tx); err != nil {
+			tx.Rollback()
+			panic(fmt.Errorf("migration %d: %w", version, err))
+		}
+
+		// pragmas can't take bound parameters
+		_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version=%d;", version+1))
+		if err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			panic(err)
+		}
+	}
+}
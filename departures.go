@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultLastChanceDays = 3
+
+// Movies whose final showing across all cinemas is within the given number
+// of days. Expects the showings to be sorted already.
+func findLastChance(periodToMovie map[timePeriod]map[string]*movieInfo, days int) map[string]*movieInfo {
+	deadline := time.Now().AddDate(0, 0, days)
+
+	titleToMovie := map[string]*movieInfo{}
+	for _, movieMap := range periodToMovie {
+		for title, movieInfoPtr := range movieMap {
+			showings := movieInfoPtr.showings
+			if len(showings) > 0 && showings[len(showings)-1].time.Before(deadline) {
+				titleToMovie[title] = movieInfoPtr
+			}
+		}
+	}
+
+	return titleToMovie
+}
+
+// Movies which had showings in the previous run but have none now. Ones
+// whose cinemas didn't all respond this time are left out, since they're
+// most likely still there.
+func findGone(previousTitleToShowings map[string][]showing, titleToShowings map[string][]showing, cinemaToReceived map[cinema]bool, dbPtr *sql.DB) map[string]*movieInfo {
+	titleToMovie := map[string]*movieInfo{}
+	for title, previousShowings := range previousTitleToShowings {
+		if _, ok := titleToShowings[title]; ok {
+			continue
+		}
+
+		if slices.ContainsFunc(previousShowings, func(s showing) bool {
+			return !cinemaToReceived[s.cinema]
+		}) {
+			continue
+		}
+
+		titleToMovie[title] = &movieInfo{
+			extIds:   loadExtIds(title, dbPtr),
+			showings: previousShowings,
+		}
+	}
+
+	return titleToMovie
+}
+
+// One line per movie, with its final showing.
+func writeLastChance(sb *strings.Builder, titleToMovie map[string]*movieInfo) {
+	for _, title := range sortedTitles(titleToMovie) {
+		movieInfoPtr := titleToMovie[title]
+		lastShowing := movieInfoPtr.showings[len(movieInfoPtr.showings)-1]
+
+		lastChanceLine := fmt.Sprintf(`%s  last: [%s](%s) [%s](%s)  \n`,
+			formatTitleLink(title, movieInfoPtr),
+			lastShowing.cinema, lastShowing.cinema.info().Website,
+			formatShowingTime(lastShowing.time), lastShowing.url)
+		sb.WriteString(lastChanceLine)
+	}
+}
+
+// One line per movie, with its first showing.
+func writeComingSoon(sb *strings.Builder, titleToMovie map[string]*movieInfo) {
+	for _, title := range sortedTitles(titleToMovie) {
+		movieInfoPtr := titleToMovie[title]
+		firstShowing := movieInfoPtr.showings[0]
+
+		comingSoonLine := fmt.Sprintf(`%s  from: [%s](%s) [%s](%s)  \n`,
+			formatTitleLink(title, movieInfoPtr),
+			firstShowing.cinema, firstShowing.cinema.info().Website,
+			formatShowingTime(firstShowing.time), firstShowing.url)
+		sb.WriteString(comingSoonLine)
+	}
+}
+
+func writeGone(sb *strings.Builder, titleToMovie map[string]*movieInfo) {
+	for _, title := range sortedTitles(titleToMovie) {
+		sb.WriteString(fmt.Sprintf(`%s  \n`, formatTitleLink(title, titleToMovie[title])))
+	}
+}
+
+// The bold title, linked to the movie db if it's known there.
+func formatTitleLink(title string, movieInfoPtr *movieInfo) string {
+	titleFormatted := strings.Replace(title, "\"", "\\\"", -1)
+	if movieUrl := movieLink(movieInfoPtr); movieUrl != "" {
+		return fmt.Sprintf(`**[%s](%s)**`, titleFormatted, movieUrl)
+	}
+	return fmt.Sprintf(`**%s**`, titleFormatted)
+}
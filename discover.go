@@ -0,0 +1,265 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/cookiejar"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+var discoverUrls = map[string]string{
+	"CCityCinemasStart": "https://www.cinema-city.pl/pl/data-api-service/v1/quickbook/10103/cinemas/with-event/until/",
+	"CCityWebsiteEnd":   "#/buy-tickets-by-cinema?in-cinema=",
+	"MultikinoCinemas":  "https://multikino.pl/api/microservice/cinemas",
+	"MultikinoWebsite":  "https://www.multikino.pl/repertuar/",
+}
+
+// The chains' names are prepended to their locations', for the ID as well.
+var sourceNamePrefixes = map[string][2]string{
+	"cinema-city": {"Cinema City", "CCity"},
+	"multikino":   {"Multikino", "Multikino"},
+}
+
+type discoveredCinema struct {
+	apiId     string
+	name      string
+	city      string
+	address   string
+	latitude  float64
+	longitude float64
+	website   string
+}
+
+// Both chains' cinema lists, keyed by the source.
+func discoverCinemas() (map[string][]discoveredCinema, error) {
+	sourceToCinemas := map[string][]discoveredCinema{}
+	discoverers := []struct {
+		source string
+		fun    func() ([]discoveredCinema, error)
+	}{
+		{"cinema-city", discoverCCity},
+		{"multikino", discoverMultikino},
+	}
+
+	for _, discoverer := range discoverers {
+		cinemas, err := recoverDiscovery(discoverer.fun)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", discoverer.source, err)
+		}
+		sourceToCinemas[discoverer.source] = cinemas
+	}
+
+	return sourceToCinemas, nil
+}
+
+// Like the fetchers, failed type assertions mean the API has changed.
+func recoverDiscovery(fun func() ([]discoveredCinema, error)) (cinemas []discoveredCinema, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unexpected response: %v", r)
+		}
+	}()
+	return fun()
+}
+
+func discoverCCity() ([]discoveredCinema, error) {
+	until := time.Now().AddDate(1, 0, 0).Format(time.DateOnly)
+	res, err := http.Get(discoverUrls["CCityCinemasStart"] + until + "?attr=&lang=pl_PL")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var body map[string]any
+	bodyBytes, _ := io.ReadAll(res.Body)
+	if err := json.Unmarshal(bodyBytes, &body); err != nil {
+		return nil, err
+	}
+
+	body = body["body"].(map[string]any)
+	cinemas := []discoveredCinema{}
+	for _, e := range body["cinemas"].([]any) {
+		cinemaJson := e.(map[string]any)
+		discovered := discoveredCinema{
+			apiId: cinemaJson["id"].(string),
+			name:  cinemaJson["displayName"].(string),
+		}
+		discovered.website, _ = cinemaJson["link"].(string)
+		if discovered.website != "" {
+			discovered.website += discoverUrls["CCityWebsiteEnd"] + discovered.apiId
+		}
+		discovered.latitude, _ = cinemaJson["latitude"].(float64)
+		discovered.longitude, _ = cinemaJson["longitude"].(float64)
+
+		if addressJson, ok := cinemaJson["addressInfo"].(map[string]any); ok {
+			discovered.city, _ = addressJson["city"].(string)
+			street, _ := addressJson["address1"].(string)
+			discovered.address = joinNonEmpty(", ", street, discovered.city)
+		}
+
+		cinemas = append(cinemas, discovered)
+	}
+
+	return cinemas, nil
+}
+
+func discoverMultikino() ([]discoveredCinema, error) {
+	client := &http.Client{}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client.Jar = jar
+
+	// Obtain cookies
+	res, err := client.Get(apiUrls["MultikinoCookies"])
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	res, err = client.Get(discoverUrls["MultikinoCinemas"])
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var body map[string]any
+	bodyBytes, _ := io.ReadAll(res.Body)
+	if err := json.Unmarshal(bodyBytes, &body); err != nil {
+		return nil, err
+	}
+
+	cinemas := []discoveredCinema{}
+	for _, e := range body["result"].([]any) {
+		cinemaJson := e.(map[string]any)
+		discovered := discoveredCinema{
+			apiId: cinemaJson["cinemaId"].(string),
+			name:  cinemaJson["cinemaName"].(string),
+		}
+		discovered.city, _ = cinemaJson["cityName"].(string)
+		discovered.latitude, _ = cinemaJson["latitude"].(float64)
+		discovered.longitude, _ = cinemaJson["longitude"].(float64)
+		if slug, ok := cinemaJson["slug"].(string); ok {
+			discovered.website = discoverUrls["MultikinoWebsite"] + slug + "/teraz-gramy"
+		}
+
+		if addressJson, ok := cinemaJson["address"].(map[string]any); ok {
+			street, _ := addressJson["line1"].(string)
+			discovered.address = joinNonEmpty(", ", street, discovered.city)
+		}
+
+		cinemas = append(cinemas, discovered)
+	}
+
+	return cinemas, nil
+}
+
+// Adds the discovered cinemas missing from the registry as disabled ones
+// (along with their cities), and refreshes the details of the known ones
+// without touching their IDs, names or whether they're enabled. Returns how
+// many were added.
+func mergeDiscoveredCinemas(registry *registry, sourceToCinemas map[string][]discoveredCinema) int {
+	added := 0
+
+	for _, source := range slices.Sorted(maps.Keys(sourceToCinemas)) {
+		for _, discovered := range sourceToCinemas[source] {
+			cityId := cityIdFromName(discovered.city)
+			if cityId != "" && !slices.ContainsFunc(registry.Cities, func(c cityInfo) bool {
+				return c.Id == cityId
+			}) {
+				registry.Cities = append(registry.Cities, cityInfo{cityId, discovered.city})
+			}
+
+			known := false
+			for i := range registry.Cinemas {
+				info := &registry.Cinemas[i]
+				if info.Source != source || info.ApiId != discovered.apiId {
+					continue
+				}
+
+				known = true
+				info.Address = cmp.Or(discovered.address, info.Address)
+				info.Website = cmp.Or(discovered.website, info.Website)
+				if discovered.latitude != 0 || discovered.longitude != 0 {
+					info.Latitude, info.Longitude = discovered.latitude, discovered.longitude
+				}
+			}
+			if known {
+				continue
+			}
+
+			prefixes := sourceNamePrefixes[source]
+			id := cinema(prefixes[1] + identifierFromName(discovered.name))
+			if slices.ContainsFunc(registry.Cinemas, func(info cinemaInfo) bool {
+				return info.Id == id
+			}) {
+				id += cinema(discovered.apiId)
+			}
+			registry.Cinemas = append(registry.Cinemas, cinemaInfo{
+				Id:        id,
+				Name:      prefixes[0] + " " + discovered.name,
+				City:      cityId,
+				Address:   discovered.address,
+				Latitude:  discovered.latitude,
+				Longitude: discovered.longitude,
+				Website:   discovered.website,
+				Source:    source,
+				ApiId:     discovered.apiId,
+				Enabled:   false,
+			})
+			added++
+		}
+	}
+
+	return added
+}
+
+// e.g. 'Kraków' -> 'krakow', 'Zielona Góra' -> 'zielona-gora'
+func cityIdFromName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(foldDiacritics(name))), "-")
+}
+
+// e.g. 'Złote Tarasy' -> 'ZloteTarasy'
+func identifierFromName(name string) string {
+	var sb strings.Builder
+	for _, word := range strings.FieldsFunc(foldDiacritics(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		sb.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return sb.String()
+}
+
+// 'ł' has no decomposition, so it's the only one replaced by hand.
+var strokeReplacer = strings.NewReplacer("ł", "l", "Ł", "L")
+
+func foldDiacritics(s string) string {
+	folder := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(folder, strokeReplacer.Replace(s))
+	if err != nil {
+		return s
+	}
+	return folded
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	nonEmpty := []string{}
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, sep)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+type healthStatus int
+
+const (
+	Healthy healthStatus = iota
+	Degraded
+	Failing
+)
+
+var healthStatusNames = map[healthStatus]string{
+	Healthy:  "OK",
+	Degraded: "DEGRADED",
+	Failing:  "FAILING",
+}
+
+// below this share of elements yielding a title/date/URL a source is degraded
+const minHealthyExtractionRatio = 0.8
+
+const doctorFetchTimeout = 60 * time.Second
+
+type siteHealth struct {
+	cinema   cinema
+	source   string
+	elements int
+	titles   int
+	dates    int
+	urls     int
+	status   healthStatus
+	notes    []string
+}
+
+// Runs every source once without touching the db, printing how well each
+// one's selectors or API responses still work. The exit code is the worst
+// status, so that 0 means all healthy, 1 degraded and 2 failing.
+func doctor(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	cityFlagPtr := flags.String("city", defaultCity, "ID of the city from the cinema registry whose cinemas to check.")
+	cinemasFlagPtr := flags.String("cinemas-config", "", "Path to the cinema registry, replacing the built-in one.")
+	scrapersFlagPtr := flags.String("scrapers", "", "Path to the scraped cinemas' definitions, replacing the built-in ones.")
+	flags.Parse(args)
+
+	if err := setupCinemas(*cinemasFlagPtr, *scrapersFlagPtr, *cityFlagPtr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return int(Failing)
+	}
+
+	healths := make([]siteHealth, len(cinemasToScrape)+len(cinemasToFetch))
+	var probeWg sync.WaitGroup
+
+	for i, site := range cinemasToScrape {
+		probeWg.Go(func() {
+			healths[i] = probeScrapeSite(site)
+		})
+	}
+	for i, site := range cinemasToFetch {
+		probeWg.Go(func() {
+			healths[len(cinemasToScrape)+i] = probeFetchSite(site)
+		})
+	}
+	probeWg.Wait()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CINEMA\tSOURCE\tELEMENTS\tTITLES\tDATES\tURLS\tSTATUS\tNOTES")
+
+	worstStatus := Healthy
+	for _, health := range healths {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\n",
+			health.cinema, health.source, health.elements, health.titles,
+			health.dates, health.urls, healthStatusNames[health.status],
+			strings.Join(health.notes, "; "))
+		worstStatus = max(worstStatus, health.status)
+	}
+	w.Flush()
+
+	return int(worstStatus)
+}
+
+func probeScrapeSite(site scrapeSite) siteHealth {
+	health := siteHealth{cinema: site.cinema, source: "scrape"}
+	var healthMu sync.Mutex
+
+	stickyValues := map[*fieldSpec]string{}
+	err := visitSite(site, func(e *colly.HTMLElement) {
+		healthMu.Lock()
+		defer healthMu.Unlock()
+
+		title, _, url, err := extractShowing(&site, e, stickyValues)
+		if errors.Is(err, errSkipShowing) && title != "" {
+			// not a showing, so it shouldn't count against the rest
+			return
+		}
+
+		health.elements++
+		if title == "" {
+			return
+		}
+		health.titles++
+
+		if err != nil {
+			return
+		}
+		health.dates++
+
+		if url != "" {
+			health.urls++
+		}
+	})
+
+	if err != nil {
+		health.notes = append(health.notes, err.Error())
+	}
+
+	evaluateHealth(&health, "root selector "+site.RootSel+" matched nothing")
+
+	return health
+}
+
+func probeFetchSite(site fetchSite) siteHealth {
+	health := siteHealth{cinema: site.cinema, source: "api"}
+
+	resultCh := make(chan result)
+	go fetchCinema(site, resultCh)
+
+	var result result
+	select {
+	case result = <-resultCh:
+
+	case <-time.After(doctorFetchTimeout):
+		health.status = Failing
+		health.notes = append(health.notes, "no response")
+		return health
+	}
+
+	// every showing has a title here, but not necessarily a valid date
+	for _, showings := range result.titleToShowings {
+		for _, showing := range showings {
+			health.elements++
+			health.titles++
+			health.dates++
+			if showing.url != "" {
+				health.urls++
+			}
+		}
+	}
+
+	for _, anomaly := range result.anomalies {
+		switch anomaly.kind {
+		case UnexpectedResponse:
+			health.status = Failing
+			health.notes = append(health.notes, "unexpected response shape: "+anomaly.detail)
+		case UnparsableDate:
+			// these never made it into the showings
+			health.elements++
+			health.titles++
+		}
+	}
+
+	if health.status != Failing {
+		evaluateHealth(&health, "no showings returned")
+	}
+
+	return health
+}
+
+func evaluateHealth(health *siteHealth, emptyNote string) {
+	if health.elements == 0 || health.urls == 0 {
+		health.status = Failing
+		if health.elements == 0 {
+			health.notes = append(health.notes, emptyNote)
+		}
+	}
+
+	ratioChecks := []struct {
+		name  string
+		count int
+		of    int
+	}{
+		{"titles", health.titles, health.elements},
+		{"dates", health.dates, health.titles},
+		{"URLs", health.urls, health.dates},
+	}
+	for _, check := range ratioChecks {
+		if check.of == 0 {
+			continue
+		}
+
+		ratio := float64(check.count) / float64(check.of)
+		if ratio < minHealthyExtractionRatio {
+			health.status = max(health.status, Degraded)
+			health.notes = append(health.notes,
+				fmt.Sprintf("%s extracted for %.0f%%", check.name, 100*ratio))
+		}
+	}
+}
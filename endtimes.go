@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The ads and trailers before the film, in minutes, by the cinema's source:
+// the chains show a lot more of them than the studio cinemas.
+const defaultAdOffsets = "cinema-city=20,multikino=25,scrape=10"
+
+var sourceToAdOffsetMin = map[string]int{}
+
+// e.g. "cinema-city=20,multikino=25,scrape=10"
+func setAdOffsets(adOffsets string) error {
+	sourceToAdOffsetMin = map[string]int{}
+	for adOffset := range strings.SplitSeq(adOffsets, ",") {
+		if adOffset = strings.TrimSpace(adOffset); adOffset == "" {
+			continue
+		}
+		source, minutesStr, ok := strings.Cut(adOffset, "=")
+		minutes, err := strconv.Atoi(minutesStr)
+		if !ok || err != nil || minutes < 0 {
+			return fmt.Errorf("invalid ad offset %q, expected e.g. \"multikino=25\"", adOffset)
+		}
+		sourceToAdOffsetMin[strings.TrimSpace(source)] = minutes
+	}
+	return nil
+}
+
+// When the film's likely to end, given its length, or the zero time if
+// it isn't known.
+func (s showing) estimatedEnd(durationMin int) time.Time {
+	if durationMin <= 0 {
+		return time.Time{}
+	}
+	adOffsetMin := sourceToAdOffsetMin[s.cinema.info().Source]
+	return s.time.Add(time.Duration(adOffsetMin+durationMin) * time.Minute)
+}
+
+// Once the lengths are known. Showings of a double feature or a marathon
+// listed under one of its films are left without one, since they last longer.
+func estimateEnds(periodToMovie map[timePeriod]map[string]*movieInfo) {
+	for _, movieMap := range periodToMovie {
+		for _, movieInfoPtr := range movieMap {
+			for i, showing := range movieInfoPtr.showings {
+				if showing.combinedTitle == "" {
+					movieInfoPtr.showings[i].end = showing.estimatedEnd(movieInfoPtr.metadata.durationMin)
+				}
+			}
+		}
+	}
+}
+
+// e.g. "–22:35", or nothing if the end isn't known
+func formatEnd(s showing) string {
+	if s.end.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("–%02d:%02d", s.end.Hour(), s.end.Minute())
+}
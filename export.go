@@ -0,0 +1,135 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const icsTimeLayout = "20060102T150405Z"
+
+// lines longer than this many bytes have to be folded
+const icsMaxLineLength = 75
+
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+type exportedShowing struct {
+	Title  string `json:"title"`
+	Cinema string `json:"cinema"`
+	Start  string `json:"start"`
+	// estimated, left out if the film's length isn't known
+	End      string `json:"end,omitempty"`
+	Url      string `json:"url"`
+	Details  string `json:"details,omitempty"`
+	MovieUrl string `json:"movieUrl,omitempty"`
+
+	showing showing
+}
+
+// Every showing in the summary, including the events and the ones in their
+// own sections, by their start.
+func exportedShowings(data summaryData) []exportedShowing {
+	movieMaps := []map[string]*movieInfo{data.events}
+	for _, movieMap := range data.periodToMovie {
+		movieMaps = append(movieMaps, movieMap)
+	}
+	for _, movieMap := range data.categoryToMovies {
+		movieMaps = append(movieMaps, movieMap)
+	}
+
+	exported := []exportedShowing{}
+	for _, movieMap := range movieMaps {
+		for title, movieInfoPtr := range movieMap {
+			for _, showing := range movieInfoPtr.showings {
+				exportedShowing := exportedShowing{
+					Title:    title,
+					Cinema:   showing.cinema.String(),
+					Start:    showing.time.Format(time.RFC3339),
+					Url:      showing.url,
+					Details:  showing.details(),
+					MovieUrl: movieLink(movieInfoPtr),
+					showing:  showing,
+				}
+				if !showing.end.IsZero() {
+					exportedShowing.End = showing.end.Format(time.RFC3339)
+				}
+				exported = append(exported, exportedShowing)
+			}
+		}
+	}
+
+	slices.SortFunc(exported, func(a, b exportedShowing) int {
+		return cmp.Or(a.showing.time.Compare(b.showing.time), cmp.Compare(a.Title, b.Title))
+	})
+	return exported
+}
+
+func exportJson(path string, data summaryData) error {
+	showingsJson, err := json.MarshalIndent(exportedShowings(data), "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, showingsJson, 0644)
+}
+
+// One event per showing, lasting until its estimated end, if it's known.
+func exportIcs(path string, data summaryData) error {
+	var sb strings.Builder
+	writeIcsLine(&sb, "BEGIN:VCALENDAR")
+	writeIcsLine(&sb, "VERSION:2.0")
+	writeIcsLine(&sb, "PRODID:-//kino//"+currentCity.Name+"//PL")
+
+	now := time.Now().UTC().Format(icsTimeLayout)
+	for _, exported := range exportedShowings(data) {
+		showing := exported.showing
+		info := showing.cinema.info()
+
+		writeIcsLine(&sb, "BEGIN:VEVENT")
+		writeIcsLine(&sb, "UID:"+icsUid(exported))
+		writeIcsLine(&sb, "DTSTAMP:"+now)
+		writeIcsLine(&sb, "DTSTART:"+showing.time.UTC().Format(icsTimeLayout))
+		if !showing.end.IsZero() {
+			writeIcsLine(&sb, "DTEND:"+showing.end.UTC().Format(icsTimeLayout))
+		}
+		writeIcsLine(&sb, "SUMMARY:"+icsTextEscaper.Replace(exported.Title))
+		writeIcsLine(&sb, "LOCATION:"+icsTextEscaper.Replace(joinNonEmpty(", ", info.Name, info.Address)))
+		if exported.Details != "" {
+			writeIcsLine(&sb, "DESCRIPTION:"+icsTextEscaper.Replace(exported.Details))
+		}
+		if exported.Url != "" {
+			writeIcsLine(&sb, "URL:"+exported.Url)
+		}
+		writeIcsLine(&sb, "END:VEVENT")
+	}
+
+	writeIcsLine(&sb, "END:VCALENDAR")
+	return os.WriteFile(path, []byte(sb.String()), 0644)
+}
+
+// Stable across runs, so that calendars update the showings in place.
+func icsUid(exported exportedShowing) string {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s|%s|%d", exported.Title, exported.showing.cinema, exported.showing.time.Unix())
+	return fmt.Sprintf("%016x@kino", hash.Sum64())
+}
+
+// Folded into lines of at most 75 bytes, without splitting any characters.
+func writeIcsLine(sb *strings.Builder, line string) {
+	lineLength := 0
+	for _, r := range line {
+		runeLength := len(string(r))
+		if lineLength+runeLength > icsMaxLineLength {
+			sb.WriteString("\r\n ")
+			// the leading space counts too
+			lineLength = 1
+		}
+		sb.WriteRune(r)
+		lineLength += runeLength
+	}
+	sb.WriteString("\r\n")
+}
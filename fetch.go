@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net/http"
 	"net/http/cookiejar"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,13 +19,6 @@ type fetchSite struct {
 	processFun func(cinema, chan result)
 }
 
-var cinemaApiIds = map[cinema]string{
-	Multikino:       "0005",
-	CCityBonarka:    "1090",
-	CCityKazimierz:  "1076",
-	CCityZakopianka: "1064",
-}
-
 // TODO cleanup
 var apiUrls = map[string]string{
 	"MultikinoBase":       "https://multikino.pl/",
@@ -34,20 +31,28 @@ var apiUrls = map[string]string{
 	"CCityFilmsEnd":       "/at-date/",
 }
 
-var cinemasToFetch = [...]fetchSite{
-	{cinema: Multikino,
-		processFun: fetchMultikino},
-	{cinema: CCityBonarka,
-		processFun: fetchCCity},
-	{cinema: CCityKazimierz,
-		processFun: fetchCCity},
-	{cinema: CCityZakopianka,
-		processFun: fetchCCity},
-}
+// the enabled ones, set up by setupCinemas
+var cinemasToFetch []fetchSite
 
 func fetch(resultCh chan result) {
 	for _, cinema := range cinemasToFetch {
-		go cinema.processFun(cinema.cinema, resultCh)
+		go fetchCinema(cinema, resultCh)
+	}
+}
+
+func fetchCinema(site fetchSite, resultCh chan result) {
+	defer recoverUnexpectedResponse(site.cinema, resultCh)
+	site.processFun(site.cinema, resultCh)
+}
+
+// The APIs are undocumented, so a change in their responses shows up as a
+// failed type assertion, which shouldn't take down the whole run with it.
+func recoverUnexpectedResponse(cinema cinema, resultCh chan result) {
+	if r := recover(); r != nil {
+		resultCh <- result{
+			cinema:    cinema,
+			anomalies: []anomaly{{cinema, UnexpectedResponse, fmt.Sprint(r)}},
+		}
 	}
 }
 
@@ -69,7 +74,7 @@ func fetchMultikino(cinema cinema, resultCh chan result) {
 	}
 	res.Body.Close()
 
-	filmsUrl := apiUrls["MultikinoFilmsStart"] + cinemaApiIds[cinema] + apiUrls["MultikinoFilmsEnd"]
+	filmsUrl := apiUrls["MultikinoFilmsStart"] + cinema.info().ApiId + apiUrls["MultikinoFilmsEnd"]
 	req, _ = http.NewRequest("GET", filmsUrl, nil)
 	res, err = client.Do(req)
 	if err != nil {
@@ -86,11 +91,14 @@ func fetchMultikino(cinema cinema, resultCh chan result) {
 	}
 
 	titleToShowings := make(map[string][]showing)
+	titleToMetadata := make(map[string]movieMetadata)
+	anomalies := []anomaly{}
 	moviesJson := body["result"].([]any)
 
 	for _, e := range moviesJson {
 		movieJson := e.(map[string]any)
 		title := movieJson["filmTitle"].(string)
+		titleToMetadata[title] = parseMultikinoFilmMetadata(movieJson)
 		showings := []showing{}
 		showingGroupsJson := movieJson["showingGroups"].([]any)
 
@@ -101,21 +109,104 @@ func fetchMultikino(cinema cinema, resultCh chan result) {
 			for _, e := range sessionsJson {
 				sessionJson := e.(map[string]any)
 				timeString := sessionJson["startTime"].(string)
-				time := processDateTimeString(timeString, cinema)
+				time, err := parseShowingTime(timeString, YearMonthDay)
+				if err != nil {
+					anomalies = append(anomalies,
+						anomaly{cinema, UnparsableDate, fmt.Sprintf("%s: %s", title, err)})
+					continue
+				}
 				url := apiUrls["MultikinoBase"] + sessionJson["bookingUrl"].(string)
-				showings = append(showings, showing{cinema, time, url})
+				showings = append(showings, parseMultikinoSession(cinema, time, url, sessionJson))
 			}
 		}
-		titleToShowings[title] = showings
+		// e.g. when none of its sessions could be parsed
+		if len(showings) > 0 {
+			titleToShowings[title] = showings
+		}
 	}
 
-	resultCh <- result{cinema: cinema, titleToShowings: titleToShowings}
+	resultCh <- result{
+		cinema:          cinema,
+		titleToShowings: titleToShowings,
+		titleToMetadata: titleToMetadata,
+		anomalies:       anomalies,
+	}
+}
+
+// Multikino's attribute names worth displaying (lowercased), in the order
+// they're displayed in, named like Cinema City's.
+var multikinoAttributeNames = []struct{ name, displayName string }{
+	{"imax", "IMAX"},
+	{"4dx", "4DX"},
+	{"screenx", "ScreenX"},
+	{"vip", "VIP"},
+	{"3d", "3D"},
+	{"dubbing", "dubbing"},
+	{"napisy", "napisy"},
+	{"wersja oryginalna", "wersja oryginalna"},
+	{"lektor", "lektor"},
+}
+
+// Everything apart from the start time and booking URL is optional, since
+// older sessions in the payload don't have all of it.
+func parseMultikinoSession(cinema cinema, startTime time.Time, url string, sessionJson map[string]any) showing {
+	session := showing{cinema: cinema, time: startTime, url: url}
+	session.screen, _ = sessionJson["screenName"].(string)
+
+	attributeNames := []string{}
+	if attributesJson, ok := sessionJson["attributes"].([]any); ok {
+		for _, e := range attributesJson {
+			attributeJson := e.(map[string]any)
+			name, _ := attributeJson["name"].(string)
+			attributeNames = append(attributeNames, strings.ToLower(name))
+		}
+	}
+	session.attributes = []string{}
+	for _, attribute := range multikinoAttributeNames {
+		if slices.Contains(attributeNames, attribute.name) {
+			session.attributes = append(session.attributes, attribute.displayName)
+		}
+	}
+
+	if soldOut, ok := sessionJson["isSoldOut"].(bool); ok {
+		session.availability = Available
+		if soldOut {
+			session.availability = SoldOut
+		} else if sellingFast, _ := sessionJson["isSellingFast"].(bool); sellingFast {
+			session.availability = SellingFast
+		}
+	}
+
+	return session
+}
+
+func parseMultikinoFilmMetadata(movieJson map[string]any) movieMetadata {
+	var metadata movieMetadata
+	if runningTime, ok := movieJson["runningTime"].(float64); ok {
+		metadata.durationMin = int(runningTime)
+	}
+	metadata.ageRating, _ = movieJson["certificate"].(string)
+	metadata.posterUrl, _ = movieJson["posterImageSrc"].(string)
+
+	// either names or objects with them, e.g. "Opera" for its event screenings
+	if genresJson, ok := movieJson["genres"].([]any); ok {
+		for _, e := range genresJson {
+			if genreJson, ok := e.(map[string]any); ok {
+				e = genreJson["name"]
+			}
+			if genre, ok := e.(string); ok && genre != "" {
+				metadata.genres = append(metadata.genres, genre)
+			}
+		}
+	}
+
+	return metadata
 }
 
 func fetchCCity(cinema cinema, resultCh chan result) {
 	client := &http.Client{}
 
-	datesBasePath := apiUrls["CCityDatesStart"] + cinemaApiIds[cinema] + apiUrls["CCityDatesEnd"]
+	datesBasePath := apiUrls["CCityDatesStart"] + cinema.info().ApiId + apiUrls["CCityDatesEnd"]
 	now := time.Now()
 	today := fmt.Sprintf("%d-%02d-%02d", now.Year()+1, now.Month(), now.Day())
 	datesTodayPath := datesBasePath + today
@@ -142,26 +233,30 @@ func fetchCCity(cinema cinema, resultCh chan result) {
 	}
 	res.Body.Close()
 
-	titleToShowingsCh := make(chan map[string][]showing)
+	dayResultCh := make(chan result)
 	for _, date := range dates {
-		go fetchCCityDay(cinema, date, titleToShowingsCh)
+		go fetchCCityDay(cinema, date, dayResultCh)
 	}
 
 	titleToShowings := make(map[string][]showing)
+	titleToMetadata := make(map[string]movieMetadata)
+	anomalies := []anomaly{}
 	answerCountdown := len(dates)
 
 	// unnecessary
 WaitForCCityDay:
 	for answerCountdown > 0 {
-		var dayMovies map[string][]showing
+		var dayResult result
 		select {
-		case dayMovies = <-titleToShowingsCh:
+		case dayResult = <-dayResultCh:
 
 		case <-time.After(5 * time.Second):
 			break WaitForCCityDay
 		}
 
-		for dayTitle, dayShowings := range dayMovies {
+		anomalies = append(anomalies, dayResult.anomalies...)
+		maps.Copy(titleToMetadata, dayResult.titleToMetadata)
+		for dayTitle, dayShowings := range dayResult.titleToShowings {
 			if showings, ok := titleToShowings[dayTitle]; ok {
 				titleToShowings[dayTitle] = append(showings, dayShowings...)
 			} else {
@@ -171,12 +266,19 @@ WaitForCCityDay:
 		answerCountdown -= 1
 	}
 
-	resultCh <- result{cinema: cinema, titleToShowings: titleToShowings}
+	resultCh <- result{
+		cinema:          cinema,
+		titleToShowings: titleToShowings,
+		titleToMetadata: titleToMetadata,
+		anomalies:       anomalies,
+	}
 }
 
-func fetchCCityDay(cinema cinema, date string, titleToShowingsCh chan map[string][]showing) {
+func fetchCCityDay(cinema cinema, date string, dayResultCh chan result) {
+	defer recoverUnexpectedResponse(cinema, dayResultCh)
+
 	client := &http.Client{}
-	moviesBasePath := apiUrls["CCityFilmsStart"] + cinemaApiIds[cinema] + apiUrls["CCityFilmsEnd"]
+	moviesBasePath := apiUrls["CCityFilmsStart"] + cinema.info().ApiId + apiUrls["CCityFilmsEnd"]
 	moviesPath := moviesBasePath + date
 	req, _ := http.NewRequest("GET", moviesPath, nil)
 	res, err := client.Do(req)
@@ -194,15 +296,18 @@ func fetchCCityDay(cinema cinema, date string, titleToShowingsCh chan map[string
 	body = body["body"].(map[string]any)
 
 	idToTitle := make(map[string]string)
+	titleToMetadata := make(map[string]movieMetadata)
 	films := body["films"].([]any)
 	for _, film := range films {
 		filmMap := film.(map[string]any)
 		id := filmMap["id"].(string)
 		title := filmMap["name"].(string)
 		idToTitle[id] = title
+		titleToMetadata[title] = parseCCityFilmMetadata(filmMap)
 	}
 
 	titleToShowings := make(map[string][]showing)
+	anomalies := []anomaly{}
 	events := body["events"].([]any)
 	for _, event := range events {
 		eventMap := event.(map[string]any)
@@ -210,17 +315,81 @@ func fetchCCityDay(cinema cinema, date string, titleToShowingsCh chan map[string
 		title := idToTitle[id]
 
 		dateTimeStr := eventMap["eventDateTime"].(string)
-		dateTime := processDateTimeString(dateTimeStr, cinema)
+		dateTime, err := parseShowingTime(dateTimeStr, YearMonthDay)
+		if err != nil {
+			anomalies = append(anomalies,
+				anomaly{cinema, UnparsableDate, fmt.Sprintf("%s: %s", title, err)})
+			continue
+		}
 
 		url := eventMap["bookingLink"].(string)
 
-		event := showing{cinema, dateTime, url}
-		if showings, ok := titleToShowings["title"]; ok {
-			titleToShowings[title] = append(showings, event)
-		} else {
-			titleToShowings[title] = []showing{event}
+		attributeIds := []string{}
+		if attributesJson, ok := eventMap["attributeIds"].([]any); ok {
+			for _, attributeId := range attributesJson {
+				attributeIds = append(attributeIds, attributeId.(string))
+			}
+		}
+
+		event := showing{
+			cinema:     cinema,
+			time:       dateTime,
+			url:        url,
+			attributes: ccityAttributes(attributeIds),
+		}
+		titleToShowings[title] = append(titleToShowings[title], event)
+	}
+
+	dayResultCh <- result{
+		cinema:          cinema,
+		titleToShowings: titleToShowings,
+		titleToMetadata: titleToMetadata,
+		anomalies:       anomalies,
+	}
+}
+
+// Cinema City's attribute IDs worth displaying, in the order they're
+// displayed in; the rest (2D, genres, age ratings etc.) are left out.
+var ccityAttributeNames = []struct{ id, name string }{
+	{"imax", "IMAX"},
+	{"4dx", "4DX"},
+	{"screenx", "ScreenX"},
+	{"vip", "VIP"},
+	{"3d", "3D"},
+	{"dubbed", "dubbing"},
+	{"subbed", "napisy"},
+}
+
+func ccityAttributes(attributeIds []string) []string {
+	attributes := []string{}
+	for _, attribute := range ccityAttributeNames {
+		if slices.Contains(attributeIds, attribute.id) {
+			attributes = append(attributes, attribute.name)
 		}
 	}
 
-	titleToShowingsCh <- titleToShowings
+	// e.g. "original-lang-en-us", for foreign films shown as they are
+	if !slices.Contains(attributeIds, "dubbed") {
+		for _, attributeId := range attributeIds {
+			if language, ok := strings.CutPrefix(attributeId, "original-lang-"); ok &&
+				!strings.HasPrefix(language, "pl") && !slices.Contains(attributeIds, "subbed") {
+				attributes = append(attributes, "wersja oryginalna")
+				break
+			}
+		}
+	}
+
+	return attributes
+}
+
+func parseCCityFilmMetadata(filmMap map[string]any) movieMetadata {
+	var metadata movieMetadata
+	if length, ok := filmMap["length"].(float64); ok {
+		metadata.durationMin = int(length)
+	}
+	if yearStr, ok := filmMap["releaseYear"].(string); ok {
+		metadata.year, _ = strconv.Atoi(yearStr)
+	}
+	metadata.posterUrl, _ = filmMap["posterLink"].(string)
+	return metadata
 }
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TODO enums etc.
+var filmwebUrls = map[string]string{
+	"SearchStart":  "https://www.filmweb.pl/api/v1/search?query=",
+	"SearchEnd":    "&pageSize=10",
+	"PreviewStart": "https://www.filmweb.pl/api/v1/film/",
+	"PreviewEnd":   "/preview",
+	"RatingEnd":    "/rating",
+	"FilmStart":    "https://www.filmweb.pl/film/",
+	"PosterStart":  "https://fwcdn.pl/fpo",
+}
+
+// poster paths have a '$' placeholder for the size, 6 being a medium one
+const filmwebPosterSize = "6"
+
+// search hit types which can be screened (rather than e.g. people or
+// games), all but films making it an event, e.g. a concert or a TV show
+var filmwebScreenableTypes = []string{"film", "serial", "tvshow"}
+
+type filmwebCandidate struct {
+	id                 string
+	hitType            string
+	title              string
+	originalTitle      string
+	internationalTitle string
+	year               int
+	metadata           movieMetadata
+	score              float64
+}
+
+type filmwebProvider struct{}
+
+func (filmwebProvider) name() string {
+	return "filmweb"
+}
+
+func (filmwebProvider) movieUrl(extId string) string {
+	return filmwebUrls["FilmStart"] + extId
+}
+
+func (filmwebProvider) lookup(title string, year int, client *http.Client) (*metadataMatch, error) {
+	titleQuery := url.QueryEscape(title)
+	url := filmwebUrls["SearchStart"] + titleQuery + filmwebUrls["SearchEnd"]
+	req, _ := http.NewRequest("GET", url, nil)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("filmweb search %q: %s", title, res.Status)
+	}
+
+	var body map[string]any
+	bodyBytes, _ := io.ReadAll(res.Body)
+	if err := json.Unmarshal(bodyBytes, &body); err != nil {
+		return nil, err
+	}
+
+	searchHits, _ := body["searchHits"].([]any)
+
+	var best *filmwebCandidate
+	candidateCount := 0
+	for _, e := range searchHits {
+		if candidateCount == maxMatchCandidates {
+			break
+		}
+
+		searchHit, _ := e.(map[string]any)
+		hitType, _ := searchHit["type"].(string)
+		if !slices.Contains(filmwebScreenableTypes, hitType) {
+			continue
+		}
+		idRaw, ok := searchHit["id"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("filmweb search %q: hit without an id", title)
+		}
+		candidateCount++
+
+		id := strconv.Itoa(int(idRaw))
+		candidate, err := fetchFilmwebPreview(id, client)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		candidate.hitType = hitType
+		candidate.score = scoreCandidate(title, year,
+			[]string{candidate.title, candidate.originalTitle, candidate.internationalTitle},
+			candidate.year, hitType == "film")
+
+		if best == nil || candidate.score > best.score {
+			best = candidate
+		}
+	}
+
+	if best == nil {
+		return nil, nil
+	}
+
+	// an unsure match might well be another title altogether, so what it's
+	// listed as can't make a film an event
+	if best.hitType != "film" && best.score >= minMatchConfidence {
+		best.metadata.kind = best.hitType
+	}
+
+	secondaryTitle := best.internationalTitle
+	if secondaryTitle == "" && best.title != best.originalTitle {
+		secondaryTitle = best.originalTitle
+	}
+
+	best.metadata.rating, err = fetchFilmwebRating(best.id, client)
+	if err != nil {
+		// not worth discarding the rest of the match over
+		log.Println(err)
+	}
+
+	return &metadataMatch{
+		provider:       "filmweb",
+		extId:          createFullFilmwebId(best.title, strconv.Itoa(best.year), best.id),
+		secondaryTitle: secondaryTitle,
+		confidence:     best.score,
+		metadata:       best.metadata,
+	}, nil
+}
+
+func fetchFilmwebPreview(id string, client *http.Client) (*filmwebCandidate, error) {
+	url := filmwebUrls["PreviewStart"] + id + filmwebUrls["PreviewEnd"]
+	req, _ := http.NewRequest("GET", url, nil)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("filmweb preview %s: %s", id, res.Status)
+	}
+
+	var body map[string]any
+	bodyBytes, _ := io.ReadAll(res.Body)
+	if err := json.Unmarshal(bodyBytes, &body); err != nil {
+		return nil, err
+	}
+
+	candidate := &filmwebCandidate{id: id}
+
+	if titleMap, ok := body["originalTitle"].(map[string]any); ok {
+		candidate.originalTitle, _ = titleMap["title"].(string)
+	}
+	if titleMap, ok := body["internationalTitle"].(map[string]any); ok {
+		candidate.internationalTitle, _ = titleMap["title"].(string)
+	}
+
+	if titleMap, ok := body["title"].(map[string]any); ok {
+		candidate.title, _ = titleMap["title"].(string)
+	} else {
+		// polish movies usually only have originalTitle it seems
+		candidate.title = candidate.originalTitle
+	}
+
+	if candidate.title == "" {
+		return nil, fmt.Errorf("filmweb preview %s has no title", id)
+	}
+
+	if yearRaw, ok := body["year"].(float64); ok {
+		candidate.year = int(yearRaw)
+	}
+
+	candidate.metadata = parseFilmwebMetadata(body)
+	candidate.metadata.year = candidate.year
+
+	return candidate, nil
+}
+
+// Everything here is optional, since plenty of entries (especially shorts
+// and older films) are missing some of it.
+func parseFilmwebMetadata(body map[string]any) movieMetadata {
+	var metadata movieMetadata
+
+	if durationRaw, ok := body["duration"].(float64); ok {
+		metadata.durationMin = int(durationRaw)
+	}
+
+	genresRaw, _ := body["genres"].([]any)
+	for _, e := range genresRaw {
+		genreMap, _ := e.(map[string]any)
+		nameMap, _ := genreMap["name"].(map[string]any)
+		if name, ok := nameMap["text"].(string); ok {
+			metadata.genres = append(metadata.genres, name)
+		}
+	}
+
+	countriesRaw, _ := body["countries"].([]any)
+	for _, e := range countriesRaw {
+		countryMap, _ := e.(map[string]any)
+		if code, ok := countryMap["code"].(string); ok {
+			metadata.countries = append(metadata.countries, code)
+		}
+	}
+
+	directorsRaw, _ := body["directors"].([]any)
+	if len(directorsRaw) > 0 {
+		directorMap, _ := directorsRaw[0].(map[string]any)
+		metadata.director, _ = directorMap["name"].(string)
+	}
+
+	posterMap, _ := body["poster"].(map[string]any)
+	if path, ok := posterMap["path"].(string); ok {
+		metadata.posterUrl = filmwebUrls["PosterStart"] +
+			strings.Replace(path, "$", filmwebPosterSize, 1)
+	}
+
+	return metadata
+}
+
+func fetchFilmwebRating(id string, client *http.Client) (float64, error) {
+	url := filmwebUrls["PreviewStart"] + id + filmwebUrls["RatingEnd"]
+	req, _ := http.NewRequest("GET", url, nil)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("filmweb rating %s: %s", id, res.Status)
+	}
+
+	var body map[string]any
+	bodyBytes, _ := io.ReadAll(res.Body)
+	if err := json.Unmarshal(bodyBytes, &body); err != nil {
+		return 0, err
+	}
+
+	rating, _ := body["rate"].(float64)
+
+	return rating, nil
+}
+
+// JS's \s, which unlike Go's also covers unicode spaces
+var filmwebSlugReplacedRegex = regexp.MustCompile(`[?!;/#\s\p{Zs}\x{2028}\x{2029}\x{FEFF}]`)
+var multiplePlusesRegex = regexp.MustCompile(`\+{2,}`)
+
+// Based on the following JS funs from filmweb.pl,
+// where type is assumed to be "film":
+//
+//	function u({type: e, title: r, year: n, id: i}) {
+//	    return `${t()}/${e}/${s(r)}-${n}-${i}`
+//	}
+//
+//	function s(e="") {
+//	    return encodeURIComponent(e.replace(/[?!;/#\s]/g, " ").trim()).replace(/'/g, "%27").replace(/\+/g, "%2B").
+//			        replace(/\(/g, "%28").replace(/\)/g, "%29").replace(/%20/g, "+").replace(/\+{2,}/g, "+")
+//	}
+func createFullFilmwebId(rawTitle string, year string, id string) string {
+	return fmt.Sprintf("%s-%s-%s", filmwebSlug(rawTitle), year, id)
+}
+
+// e.g. "Diuna-2021-1234567" -> "1234567"
+func filmwebNumericId(fullId string) string {
+	return fullId[strings.LastIndex(fullId, "-")+1:]
+}
+
+func filmwebSlug(title string) string {
+	title = filmwebSlugReplacedRegex.ReplaceAllString(title, " ")
+	title = strings.TrimSpace(title)
+
+	slug := encodeURIComponent(title)
+	slug = strings.ReplaceAll(slug, "'", "%27")
+	slug = strings.ReplaceAll(slug, "+", "%2B")
+	slug = strings.ReplaceAll(slug, "(", "%28")
+	slug = strings.ReplaceAll(slug, ")", "%29")
+	slug = strings.ReplaceAll(slug, "%20", "+")
+	slug = multiplePlusesRegex.ReplaceAllString(slug, "+")
+
+	return slug
+}
+
+// Unlike url.QueryEscape, leaves "!'()*~" as they are and encodes spaces as "%20".
+func encodeURIComponent(s string) string {
+	const upperHex = "0123456789ABCDEF"
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' ||
+			strings.IndexByte("-_.!~*'()", b) != -1 {
+			sb.WriteByte(b)
+		} else {
+			sb.WriteByte('%')
+			sb.WriteByte(upperHex[b>>4])
+			sb.WriteByte(upperHex[b&15])
+		}
+	}
+
+	return sb.String()
+}
+
+// Ids stored before the slug was ported were "url.QueryEscape(title)-year-id",
+// which gets converted to the proper slug here.
+func regenerateFilmwebIds(tx *sql.Tx) error {
+	rows, err := tx.Query(`
+		SELECT title, ext_db_id
+			FROM movies
+			WHERE ext_db_id IS NOT NULL AND ext_db_id != '';
+	`)
+	if err != nil {
+		return err
+	}
+
+	titleToNewId := map[string]string{}
+	for rows.Next() {
+		var title, oldId string
+		if err := rows.Scan(&title, &oldId); err != nil {
+			rows.Close()
+			return err
+		}
+
+		idSep := strings.LastIndex(oldId, "-")
+		if idSep == -1 {
+			continue
+		}
+		yearSep := strings.LastIndex(oldId[:idSep], "-")
+		if yearSep == -1 {
+			continue
+		}
+
+		filmwebTitle, err := url.QueryUnescape(oldId[:yearSep])
+		if err != nil {
+			continue
+		}
+
+		titleToNewId[title] =
+			createFullFilmwebId(filmwebTitle, oldId[yearSep+1:idSep], oldId[idSep+1:])
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for title, newId := range titleToNewId {
+		_, err := tx.Exec(`
+			UPDATE movies
+				SET ext_db_id = ?
+				WHERE title = ?;
+		`, newId, title)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
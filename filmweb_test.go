@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFilmwebSlug(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Diuna", "Diuna"},
+		{"Diuna: Część druga", "Diuna%3A+Cz%C4%99%C5%9B%C4%87+druga"},
+		{"Mad Max: Na drodze gniewu!", "Mad+Max%3A+Na+drodze+gniewu"},
+		{"Co w duszy gra?", "Co+w+duszy+gra"},
+		{"AC/DC; Live #1", "AC+DC+Live+1"},
+		{"Ocean's Eleven", "Ocean%27s+Eleven"},
+		{`"Bękarty wojny"`, "%22B%C4%99karty+wojny%22"},
+		{"Romeo + Julia", "Romeo+%2B+Julia"},
+		{"Nosferatu (1922)", "Nosferatu+%281922%29"},
+		{"Ósmy dzień tygodnia", "%C3%93smy+dzie%C5%84+tygodnia"},
+		{"Żółć", "%C5%BB%C3%B3%C5%82%C4%87"},
+		{"Pulp\u00a0Fiction", "Pulp+Fiction"},
+		{"Pulp\u2003\u2009Fiction", "Pulp+Fiction"},
+		{"Pulp\u2028Fiction\ufeff", "Pulp+Fiction"},
+		{"\tDiuna  \n", "Diuna"},
+		{"Kill Bill: Vol. 1 *~", "Kill+Bill%3A+Vol.+1+*~"},
+	}
+
+	for _, test := range tests {
+		if got := filmwebSlug(test.title); got != test.want {
+			t.Errorf("filmwebSlug(%q) = %q, want %q", test.title, got, test.want)
+		}
+	}
+}
+
+func TestRegenerateFilmwebIds(t *testing.T) {
+	dbPtr, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbPtr.Close()
+	dbPtr.SetMaxOpenConns(1)
+
+	tx, err := dbPtr.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	// the schema as it was right before the migration
+	for _, migration := range migrations[:3] {
+		if err := migration(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO movies (title, first_seen, last_seen, ext_db_id)
+			VALUES
+				('DIUNA CZĘŚĆ DRUGA', '2024-02-29', '2024-03-01', 'Diuna%3A+Cz%C4%99%C5%9B%C4%87+druga-2024-10010245'),
+				('CO W DUSZY GRA', '2024-02-29', '2024-03-01', 'Co+w+duszy+gra%3F-2020-792968'),
+				('ACDC', '2024-02-29', '2024-03-01', 'AC%2FDC%21-2009-511'),
+				('KILL BILL', '2024-02-29', '2024-03-01', 'Kill+Bill%2A-2003-1146'),
+				('BEZ ID', '2024-02-29', '2024-03-01', NULL),
+				('ZEPSUTY', '2024-02-29', '2024-03-01', 'bez-separatorow');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := regenerateFilmwebIds(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]sql.NullString{
+		"DIUNA CZĘŚĆ DRUGA": {String: "Diuna%3A+Cz%C4%99%C5%9B%C4%87+druga-2024-10010245", Valid: true},
+		"CO W DUSZY GRA":    {String: "Co+w+duszy+gra-2020-792968", Valid: true},
+		"ACDC":              {String: "AC+DC-2009-511", Valid: true},
+		"KILL BILL":         {String: "Kill+Bill*-2003-1146", Valid: true},
+		"BEZ ID":            {},
+		"ZEPSUTY":           {String: "bez-separatorow", Valid: true},
+	}
+	for title, wantId := range want {
+		var gotId sql.NullString
+		err := tx.QueryRow(`SELECT ext_db_id FROM movies WHERE title = ?;`, title).Scan(&gotId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotId != wantId {
+			t.Errorf("%s: ext_db_id = %v, want %v", title, gotId, wantId)
+		}
+	}
+}
+
+func TestFilmwebLookupKind(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"searchHits": [{"id": 1, "type": "tvshow"}, {"id": 2, "type": "person"}]}`))
+	})
+	mux.HandleFunc("/film/1/preview", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"title": {"title": "Koncert noworoczny"}, "year": 2026}`))
+	})
+	mux.HandleFunc("/film/1/rating", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"rate": 7.1}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	previousUrls := maps.Clone(filmwebUrls)
+	defer func() { filmwebUrls = previousUrls }()
+	filmwebUrls["SearchStart"] = server.URL + "/search?query="
+	filmwebUrls["PreviewStart"] = server.URL + "/film/"
+
+	tests := []struct {
+		title    string
+		wantKind string
+	}{
+		{"KONCERT NOWOROCZNY", "tvshow"},
+		// a film whose only hit is something else entirely
+		{"ZUPEŁNIE INNY FILM", ""},
+	}
+
+	for _, test := range tests {
+		match, err := filmwebProvider{}.lookup(test.title, 2026, server.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match == nil {
+			t.Fatalf("%s: no match", test.title)
+		}
+		if match.metadata.kind != test.wantKind {
+			t.Errorf("%s: kind = %q (confidence %.2f), want %q",
+				test.title, match.metadata.kind, match.confidence, test.wantKind)
+		}
+	}
+}
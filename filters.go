@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Where a summary goes, and which showings it's about.
+type notifier struct {
+	Name         string `json:"name"`
+	GotifyOrigin string `json:"gotifyOrigin"`
+	GotifyToken  string `json:"gotifyToken"`
+	Log          bool   `json:"log"`
+	// paths to export the showings to, if any
+	Ics    string        `json:"ics"`
+	Json   string        `json:"json"`
+	Filter showingFilter `json:"filter"`
+}
+
+// Every set criterion has to be met. Showings and movies missing whatever
+// a criterion is about (e.g. scraped showings have no language version,
+// movies not found in a movie db have no rating) aren't filtered out by it.
+type showingFilter struct {
+	Cinemas         []cinema `json:"cinemas"`
+	ExcludedCinemas []cinema `json:"excludedCinemas"`
+	// e.g. "17:00", "23:30", the window can go past midnight
+	From string `json:"from"`
+	To   string `json:"to"`
+	// e.g. ["sat", "sun"]
+	Weekdays    []string `json:"weekdays"`
+	MinRating   float64  `json:"minRating"`
+	Genres      []string `json:"genres"`
+	Versions    []string `json:"versions"`
+	ExcludeKids bool     `json:"excludeKids"`
+	// the previously excluded ones are hidden if it isn't given, "[]" shows them all
+	HiddenCategories []eventCategory `json:"hiddenCategories"`
+	// listed in their own sections, rather than under the film
+	SectionCategories []eventCategory `json:"sectionCategories"`
+
+	// minutes since midnight, -1 if unset
+	fromMin  int
+	toMin    int
+	weekdays []time.Weekday
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+	"sun": time.Sunday,
+}
+
+// the showing attributes which are language versions, rather than formats
+var versionAttributes = []string{"dubbing", "napisy", "wersja oryginalna", "lektor"}
+
+// movies of the first genre are always for kids, of the second one when dubbed
+const (
+	kidsGenre       = "Familijny"
+	kidsDubbedGenre = "Animacja"
+)
+
+func loadNotifiers(path string) ([]notifier, error) {
+	notifiersJson, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifiers []notifier
+	if err := json.Unmarshal(notifiersJson, &notifiers); err != nil {
+		return nil, fmt.Errorf("notifiers: %w", err)
+	}
+
+	for i := range notifiers {
+		if err := notifiers[i].Filter.compile(); err != nil {
+			return nil, fmt.Errorf("notifier %s: %w", notifiers[i].Name, err)
+		}
+	}
+
+	return notifiers, nil
+}
+
+func (f *showingFilter) compile() error {
+	var err error
+	if f.fromMin, err = parseMinuteOfDay(f.From); err != nil {
+		return err
+	}
+	if f.toMin, err = parseMinuteOfDay(f.To); err != nil {
+		return err
+	}
+
+	f.weekdays = []time.Weekday{}
+	for _, name := range f.Weekdays {
+		weekday, ok := weekdayNames[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("unknown weekday %q", name)
+		}
+		f.weekdays = append(f.weekdays, weekday)
+	}
+
+	if f.HiddenCategories == nil {
+		f.HiddenCategories = defaultHiddenCategories
+	}
+	for _, category := range slices.Concat(f.HiddenCategories, f.SectionCategories) {
+		if !slices.Contains(eventCategories, category) {
+			return fmt.Errorf("unknown event category %q", category)
+		}
+	}
+
+	return nil
+}
+
+func parseMinuteOfDay(clock string) (int, error) {
+	if clock == "" {
+		return -1, nil
+	}
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return -1, fmt.Errorf("invalid time of day %q", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+func (f showingFilter) keepsMovie(movieInfoPtr *movieInfo) bool {
+	metadata := movieInfoPtr.metadata
+
+	if f.MinRating > 0 && metadata.rating > 0 && metadata.rating < f.MinRating {
+		return false
+	}
+
+	if len(f.Genres) > 0 && len(metadata.genres) > 0 &&
+		!slices.ContainsFunc(metadata.genres, func(genre string) bool {
+			return slices.ContainsFunc(f.Genres, func(wanted string) bool {
+				return strings.EqualFold(genre, wanted)
+			})
+		}) {
+		return false
+	}
+
+	return true
+}
+
+func (f showingFilter) keepsShowing(showing showing, movieInfoPtr *movieInfo) bool {
+	if len(f.Cinemas) > 0 && !slices.Contains(f.Cinemas, showing.cinema) {
+		return false
+	}
+	if slices.Contains(f.ExcludedCinemas, showing.cinema) {
+		return false
+	}
+
+	minuteOfDay := showing.time.Hour()*60 + showing.time.Minute()
+	if f.fromMin != -1 && f.toMin != -1 && f.fromMin > f.toMin {
+		// past midnight, e.g. 22:00-02:00
+		if minuteOfDay < f.fromMin && minuteOfDay > f.toMin {
+			return false
+		}
+	} else if f.fromMin != -1 && minuteOfDay < f.fromMin ||
+		f.toMin != -1 && minuteOfDay > f.toMin {
+		return false
+	}
+
+	if len(f.weekdays) > 0 && !slices.Contains(f.weekdays, showing.time.Weekday()) {
+		return false
+	}
+
+	if len(f.Versions) > 0 {
+		versions := []string{}
+		for _, attribute := range showing.attributes {
+			if slices.Contains(versionAttributes, attribute) {
+				versions = append(versions, attribute)
+			}
+		}
+		if len(versions) > 0 && !slices.ContainsFunc(versions, func(version string) bool {
+			return slices.Contains(f.Versions, version)
+		}) {
+			return false
+		}
+	}
+
+	if f.ExcludeKids && isKidsScreening(showing, movieInfoPtr) {
+		return false
+	}
+
+	if slices.ContainsFunc(showing.categories, func(category eventCategory) bool {
+		return slices.Contains(f.HiddenCategories, category)
+	}) {
+		return false
+	}
+
+	return true
+}
+
+func isKidsScreening(showing showing, movieInfoPtr *movieInfo) bool {
+	if slices.Contains(showing.categories, Kids) {
+		return true
+	}
+	genres := movieInfoPtr.metadata.genres
+	if slices.Contains(genres, kidsGenre) {
+		return true
+	}
+	return slices.Contains(genres, kidsDubbedGenre) && slices.Contains(showing.attributes, "dubbing")
+}
+
+// The movie with only the showings the filter keeps, or nil if there are
+// none left (or the movie itself is filtered out).
+func (f showingFilter) filterMovie(movieInfoPtr *movieInfo) *movieInfo {
+	if !f.keepsMovie(movieInfoPtr) {
+		return nil
+	}
+
+	filtered := *movieInfoPtr
+	filtered.showings = []showing{}
+	for _, showing := range movieInfoPtr.showings {
+		if f.keepsShowing(showing, movieInfoPtr) {
+			filtered.showings = append(filtered.showings, showing)
+		}
+	}
+	if len(filtered.showings) == 0 {
+		return nil
+	}
+
+	return &filtered
+}
+
+func (f showingFilter) filterMovies(titleToMovie map[string]*movieInfo) map[string]*movieInfo {
+	filteredTitleToMovie := map[string]*movieInfo{}
+	for title, movieInfoPtr := range titleToMovie {
+		if filtered := f.filterMovie(movieInfoPtr); filtered != nil {
+			filteredTitleToMovie[title] = filtered
+		}
+	}
+	return filteredTitleToMovie
+}
+
+// Applied after the aggregation, so every notifier gets its own view of it.
+// The warnings and missing results are kept as they are, since they're
+// about the sources rather than the showings.
+func (f showingFilter) apply(data summaryData) summaryData {
+	filtered := data
+
+	filtered.periodToMovie = map[timePeriod]map[string]*movieInfo{}
+	filtered.categoryToMovies = map[eventCategory]map[string]*movieInfo{}
+	titleToMovie := map[string]*movieInfo{}
+	for period, movieMap := range data.periodToMovie {
+		filtered.periodToMovie[period] = f.filterMovies(movieMap)
+		f.moveToSections(filtered.periodToMovie[period], filtered.categoryToMovies)
+		for title, movieInfoPtr := range movieMap {
+			titleToMovie[title] = movieInfoPtr
+		}
+	}
+
+	filtered.titleToChanges = map[string][]showingChange{}
+	for title, changes := range data.titleToChanges {
+		movieInfoPtr, ok := titleToMovie[title]
+		if !ok {
+			movieInfoPtr = &movieInfo{}
+		}
+		if !f.keepsMovie(movieInfoPtr) {
+			continue
+		}
+		for _, change := range changes {
+			// the ones listed in a section are left out there as well
+			if _, ok := f.sectionCategory(change.showing); ok {
+				continue
+			}
+			if f.keepsShowing(change.showing, movieInfoPtr) {
+				filtered.titleToChanges[title] = append(filtered.titleToChanges[title], change)
+			}
+		}
+	}
+
+	filtered.lastChance = f.filterMovies(data.lastChance)
+	filtered.events = f.filterMovies(data.events)
+
+	// going by their showings from the previous run
+	filtered.gone = f.filterMovies(data.gone)
+
+	return filtered
+}
+
+// Moves the showings of the categories listed in their own sections out of
+// the movies, leaving out the movies with none left.
+func (f showingFilter) moveToSections(titleToMovie map[string]*movieInfo, categoryToMovies map[eventCategory]map[string]*movieInfo) {
+	if len(f.SectionCategories) == 0 {
+		return
+	}
+
+	for title, movieInfoPtr := range titleToMovie {
+		remaining := []showing{}
+		for _, sectionShowing := range movieInfoPtr.showings {
+			category, ok := f.sectionCategory(sectionShowing)
+			if !ok {
+				remaining = append(remaining, sectionShowing)
+				continue
+			}
+
+			if categoryToMovies[category] == nil {
+				categoryToMovies[category] = map[string]*movieInfo{}
+			}
+			sectionMovieInfoPtr, ok := categoryToMovies[category][title]
+			if !ok {
+				sectionMovie := *movieInfoPtr
+				sectionMovie.showings = []showing{}
+				sectionMovieInfoPtr = &sectionMovie
+				categoryToMovies[category][title] = sectionMovieInfoPtr
+			}
+			sectionMovieInfoPtr.showings = append(sectionMovieInfoPtr.showings, sectionShowing)
+		}
+
+		if len(remaining) == 0 {
+			delete(titleToMovie, title)
+		} else {
+			movieInfoPtr.showings = remaining
+		}
+	}
+}
+
+// The first of the categories listed in their own sections the showing is in.
+func (f showingFilter) sectionCategory(showing showing) (eventCategory, bool) {
+	sectionIndex := slices.IndexFunc(f.SectionCategories, func(category eventCategory) bool {
+		return slices.Contains(showing.categories, category)
+	})
+	if sectionIndex == -1 {
+		return "", false
+	}
+	return f.SectionCategories[sectionIndex], true
+}
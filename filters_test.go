@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyFiltersChanges(t *testing.T) {
+	previousProviders := metadataProviders
+	metadataProviders = []metadataProvider{filmwebProvider{}}
+	defer func() { metadataProviders = previousProviders }()
+
+	showingAt := func(cinema cinema, day int, categories ...eventCategory) showing {
+		return showing{
+			cinema:     cinema,
+			time:       time.Date(2026, time.October, day, 20, 0, 0, 0, warsawLocation),
+			categories: categories,
+		}
+	}
+
+	diuna := &movieInfo{
+		extIds:   map[string]extId{},
+		showings: []showing{showingAt("Kijow", 24), showingAt("Kijow", 25, Kids)},
+	}
+	data := summaryData{
+		periodToMovie: map[timePeriod]map[string]*movieInfo{
+			Earlier: {"DIUNA": diuna},
+		},
+		titleToChanges: map[string][]showingChange{
+			"DIUNA": {
+				{kind: Added, showing: showingAt("Kijow", 24)},
+				{kind: Added, showing: showingAt("Kijow", 25, Kids)},
+				{kind: Cancelled, showing: showingAt("Mikro", 23)},
+			},
+			// all of its showings were cancelled, so it's not among the movies
+			"ODWOŁANY": {
+				{kind: Cancelled, showing: showingAt("Mikro", 23)},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		filter showingFilter
+		want   map[string]int
+	}{
+		{
+			name:   "no filter",
+			filter: showingFilter{HiddenCategories: []eventCategory{}},
+			want:   map[string]int{"DIUNA": 3, "ODWOŁANY": 1},
+		},
+		{
+			name:   "other cinema",
+			filter: showingFilter{Cinemas: []cinema{"Mikro"}, HiddenCategories: []eventCategory{}},
+			want:   map[string]int{"DIUNA": 1, "ODWOŁANY": 1},
+		},
+		{
+			name:   "hidden category",
+			filter: showingFilter{HiddenCategories: []eventCategory{Kids}},
+			want:   map[string]int{"DIUNA": 2, "ODWOŁANY": 1},
+		},
+		{
+			name:   "section",
+			filter: showingFilter{HiddenCategories: []eventCategory{}, SectionCategories: []eventCategory{Kids}},
+			want:   map[string]int{"DIUNA": 2, "ODWOŁANY": 1},
+		},
+	}
+
+	for _, test := range tests {
+		if err := test.filter.compile(); err != nil {
+			t.Fatal(err)
+		}
+		filtered := test.filter.apply(data)
+
+		if len(filtered.titleToChanges) != len(test.want) {
+			t.Errorf("%s: changes of %d titles, want %d", test.name, len(filtered.titleToChanges), len(test.want))
+		}
+		for title, wantCount := range test.want {
+			if got := len(filtered.titleToChanges[title]); got != wantCount {
+				t.Errorf("%s: %d changes of %s, want %d", test.name, got, title, wantCount)
+			}
+		}
+
+		// the changes of the movies which aren't listed have to be written too
+		summary := createSummary(filtered)
+		for title := range test.want {
+			if !strings.Contains(summary, "## "+title) {
+				t.Errorf("%s: %s missing from the summary", test.name, title)
+			}
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// e.g. "/film/Diuna%3A+Cz%C4%99%C5%9B%C4%87+druga-2024-10010245", within
+// the links of a saved Filmweb "want to see" page
+var filmwebFilmLinkRegex = regexp.MustCompile(`/(?:film|serial)/([^"'/?#\s]+)-((?:19|20)\d{2})-(\d+)`)
+
+// the year and numeric ID at the end of the ones stored in the db
+var filmwebIdSuffixRegex = regexp.MustCompile(`-((?:19|20)\d{2})-(\d+)$`)
+
+type importedMovie struct {
+	title string
+	year  int
+	// only known for Filmweb's lists
+	filmwebId string
+}
+
+type knownFilmwebMovie struct {
+	titles    []string
+	year      int
+	filmwebId string
+}
+
+// Adds the movies from a Letterboxd watchlist export (.csv) or a saved
+// Filmweb "want to see" page to the watchlist, matching Letterboxd's by title
+// and year against the movies already matched on Filmweb. Unmatched ones are
+// watched by title and reported as such, matched ones keep it as a label.
+func importWatchlist(path string, dbPtr *sql.DB) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var movies []importedMovie
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		movies, err = parseLetterboxdCsv(file)
+	} else {
+		movies, err = parseFilmwebWantToSee(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	knownMovies := loadKnownFilmwebMovies(dbPtr)
+	watchlist := loadWatchlist(dbPtr)
+
+	added, skipped := 0, 0
+	unmatched := []importedMovie{}
+	for _, movie := range movies {
+		if movie.filmwebId == "" {
+			movie.filmwebId = matchFilmwebId(movie, knownMovies)
+		}
+
+		entry := watchEntry{title: movie.title, filmwebId: movie.filmwebId}
+		if entry.filmwebId == "" {
+			unmatched = append(unmatched, movie)
+		}
+
+		if slices.ContainsFunc(watchlist, func(e watchEntry) bool {
+			if e.filmwebId != "" && entry.filmwebId != "" {
+				return e.filmwebId == entry.filmwebId
+			}
+			return simplifyTitle(e.title) == simplifyTitle(entry.title)
+		}) {
+			skipped++
+			continue
+		}
+
+		addWatchEntry(entry, dbPtr)
+		watchlist = append(watchlist, entry)
+		added++
+	}
+
+	fmt.Printf("%d movies added, %d already on the watchlist\n", added, skipped)
+	if len(unmatched) > 0 {
+		fmt.Printf("%d not matched to a Filmweb ID, watched by title instead:\n", len(unmatched))
+		for _, movie := range unmatched {
+			fmt.Printf("  %s (%d)\n", movie.title, movie.year)
+		}
+	}
+
+	return nil
+}
+
+// The columns are "Date,Name,Year,Letterboxd URI".
+func parseLetterboxdCsv(reader io.Reader) ([]importedMovie, error) {
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty csv")
+	}
+
+	nameIndex := slices.Index(records[0], "Name")
+	yearIndex := slices.Index(records[0], "Year")
+	if nameIndex == -1 || yearIndex == -1 {
+		return nil, fmt.Errorf("not a Letterboxd export, no Name and Year columns")
+	}
+
+	movies := []importedMovie{}
+	for _, record := range records[1:] {
+		year, _ := strconv.Atoi(record[yearIndex])
+		movies = append(movies, importedMovie{title: record[nameIndex], year: year})
+	}
+
+	return movies, nil
+}
+
+// Every film linked on the page, once, in the order they're linked in.
+func parseFilmwebWantToSee(reader io.Reader) ([]importedMovie, error) {
+	page, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	movies := []importedMovie{}
+	seenIds := map[string]bool{}
+	for _, match := range filmwebFilmLinkRegex.FindAllStringSubmatch(string(page), -1) {
+		if seenIds[match[3]] {
+			continue
+		}
+		seenIds[match[3]] = true
+
+		title, err := url.QueryUnescape(match[1])
+		if err != nil {
+			title = match[1]
+		}
+		year, _ := strconv.Atoi(match[2])
+		movies = append(movies, importedMovie{title, year, match[3]})
+	}
+
+	if len(movies) == 0 {
+		return nil, fmt.Errorf("no Filmweb film links found")
+	}
+	return movies, nil
+}
+
+func loadKnownFilmwebMovies(dbPtr *sql.DB) []knownFilmwebMovie {
+	// matches from before confidence was tracked are trusted, as in isConfident
+	sqlSelect := `
+		SELECT movies.title, movies.secondary_title, movies.year, movie_ext_ids.ext_id
+			FROM movies
+			JOIN movie_ext_ids ON movie_ext_ids.title = movies.title
+			WHERE movie_ext_ids.provider = ?
+				AND (movie_ext_ids.confidence IS NULL OR movie_ext_ids.confidence >= ?);
+	`
+	rows, err := dbPtr.Query(sqlSelect, filmwebProvider{}.name(), minMatchConfidence)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	knownMovies := []knownFilmwebMovie{}
+	for rows.Next() {
+		var title, extId string
+		var secondaryTitle sql.NullString
+		var year sql.NullInt64
+		if err := rows.Scan(&title, &secondaryTitle, &year, &extId); err != nil {
+			panic(err)
+		}
+
+		knownMovie := knownFilmwebMovie{
+			titles:    []string{simplifyTitle(title)},
+			year:      int(year.Int64),
+			filmwebId: filmwebNumericId(extId),
+		}
+		if secondaryTitle.Valid {
+			knownMovie.titles = append(knownMovie.titles, simplifyTitle(secondaryTitle.String))
+		}
+		// the year is part of the ID, for the ones without metadata yet
+		if match := filmwebIdSuffixRegex.FindStringSubmatch(extId); match != nil && knownMovie.year == 0 {
+			knownMovie.year, _ = strconv.Atoi(match[1])
+		}
+		knownMovies = append(knownMovies, knownMovie)
+	}
+
+	return knownMovies
+}
+
+// Either title and the year have to match, unless the year isn't known.
+func matchFilmwebId(movie importedMovie, knownMovies []knownFilmwebMovie) string {
+	title := simplifyTitle(movie.title)
+	for _, knownMovie := range knownMovies {
+		if !slices.Contains(knownMovie.titles, title) {
+			continue
+		}
+		if movie.year == 0 || knownMovie.year == 0 || movie.year == knownMovie.year {
+			return knownMovie.filmwebId
+		}
+	}
+	return ""
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// how many external movie db lookups may be in flight at once
+const lookupWorkerCount = 4
+
+// titles without a match aren't looked up again until this passes
+const lookupNegativeTtl = 7 * 24 * time.Hour
+
+// minimum time between requests to the same external movie db host
+const lookupRequestInterval = 300 * time.Millisecond
+
+type lookupJob struct {
+	title        string
+	movieInfoPtr *movieInfo
+	providers    []metadataProvider
+}
+
+// Runs the lookups on a bounded pool of workers sharing one rate limited
+// client, skipping providers which recently had no match for the title.
+// Returns once all the lookups are done.
+func lookupMovies(jobs []lookupJob, dbPtr *sql.DB) {
+	client := &http.Client{
+		Transport: newRateLimitedTransport(lookupRequestInterval),
+	}
+
+	jobCh := make(chan lookupJob)
+	var workerWg sync.WaitGroup
+
+	for range lookupWorkerCount {
+		workerWg.Go(func() {
+			for job := range jobCh {
+				lookupMovie(job, client, dbPtr)
+			}
+		})
+	}
+
+	for _, job := range jobs {
+		jobCh <- job
+	}
+	close(jobCh)
+
+	workerWg.Wait()
+}
+
+// Asks the job's providers in order of preference until one of them matches
+// the title confidently, so that the rest are only a fallback for when the
+// preferred ones fail (e.g. due to an API change) or don't know the title.
+func lookupMovie(job lookupJob, client *http.Client, dbPtr *sql.DB) {
+	matches := []*metadataMatch{}
+
+	for _, provider := range job.providers {
+		if isLookupCachedMiss(provider.name(), job.title, dbPtr) {
+			continue
+		}
+
+		match, err := provider.lookup(job.title, job.movieInfoPtr.year, client)
+		if err != nil {
+			// don't cache what might be a temporary failure
+			log.Println(provider.name(), err)
+			continue
+		}
+		updateLookupCache(provider.name(), job.title, match != nil, dbPtr)
+
+		if match != nil {
+			storeExtId(job.title, match, dbPtr)
+			matches = append(matches, match)
+			if match.confidence >= minMatchConfidence {
+				break
+			}
+		}
+	}
+
+	if len(matches) > 0 {
+		applyMatches(job.title, job.movieInfoPtr, matches, dbPtr)
+	}
+}
+
+// Confident matches take precedence in the providers' order, followed by
+// what was already known about the movie. The unsure matches' ids are kept
+// for review, but not their metadata, which might well be another film's.
+func applyMatches(title string, movieInfoPtr *movieInfo, matches []*metadataMatch, dbPtr *sql.DB) {
+	confidentMatches := []*metadataMatch{}
+	for _, match := range matches {
+		movieInfoPtr.extIds[match.provider] = extId{
+			id:         match.extId,
+			confidence: sql.NullFloat64{Float64: match.confidence, Valid: true},
+		}
+
+		if match.confidence >= minMatchConfidence {
+			confidentMatches = append(confidentMatches, match)
+		}
+	}
+
+	known := &metadataMatch{
+		secondaryTitle: movieInfoPtr.secondaryTitle,
+		metadata:       movieInfoPtr.metadata,
+	}
+	orderedMatches := append(confidentMatches, known)
+
+	secondaryTitle := ""
+	metadata := movieMetadata{}
+	for _, match := range orderedMatches {
+		if secondaryTitle == "" {
+			secondaryTitle = match.secondaryTitle
+		}
+		metadata = metadata.withFallback(match.metadata)
+	}
+
+	movieInfoPtr.secondaryTitle = secondaryTitle
+	movieInfoPtr.metadata = metadata
+
+	sqlUpdate := `
+		UPDATE movies
+			SET secondary_title = ?
+			WHERE title = ?;
+	`
+	_, err := dbPtr.Exec(sqlUpdate, secondaryTitle, title)
+	if err != nil {
+		panic(err)
+	}
+
+	storeMovieMetadata(title, metadata, dbPtr)
+}
+
+func isLookupCachedMiss(provider string, title string, dbPtr *sql.DB) bool {
+	sqlSelect := `
+		SELECT found, checked_at
+			FROM lookup_cache
+			WHERE provider = ? AND query = ?;
+	`
+	var found bool
+	var checkedAtStr string
+	err := dbPtr.QueryRow(sqlSelect, provider, title).Scan(&found, &checkedAtStr)
+	if err == sql.ErrNoRows {
+		return false
+	} else if err != nil {
+		panic(err)
+	}
+
+	checkedAt, err := time.Parse(time.RFC3339, checkedAtStr)
+	if err != nil {
+		return false
+	}
+
+	return !found && time.Since(checkedAt) < lookupNegativeTtl
+}
+
+func updateLookupCache(provider string, title string, found bool, dbPtr *sql.DB) {
+	sqlUpsert := `
+		INSERT INTO lookup_cache
+			(provider, query, found, checked_at)
+			VALUES(?, ?, ?, ?)
+			ON CONFLICT(provider, query) DO UPDATE
+				SET found = excluded.found, checked_at = excluded.checked_at;
+	`
+	_, err := dbPtr.Exec(sqlUpsert, provider, title, found, time.Now().Format(time.RFC3339))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Spaces out requests to the same host by at least the given interval,
+// regardless of how many goroutines share the client.
+type rateLimitedTransport struct {
+	base     http.RoundTripper
+	interval time.Duration
+
+	mu          sync.Mutex
+	nextAllowed map[string]time.Time
+}
+
+func newRateLimitedTransport(interval time.Duration) *rateLimitedTransport {
+	return &rateLimitedTransport{
+		base:        http.DefaultTransport,
+		interval:    interval,
+		nextAllowed: map[string]time.Time{},
+	}
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	t.mu.Lock()
+	now := time.Now()
+	slot := t.nextAllowed[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	t.nextAllowed[host] = slot.Add(t.interval)
+	t.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(slot)):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type fakeProvider struct {
+	providerName string
+	match        *metadataMatch
+	err          error
+	// the names of the providers asked so far, shared between them
+	asked *[]string
+}
+
+func (p fakeProvider) name() string {
+	return p.providerName
+}
+
+func (p fakeProvider) lookup(title string, year int, client *http.Client) (*metadataMatch, error) {
+	*p.asked = append(*p.asked, p.providerName)
+	return p.match, p.err
+}
+
+func (p fakeProvider) movieUrl(extId string) string {
+	return "https://" + p.providerName + "/" + extId
+}
+
+func TestLookupMovieFallback(t *testing.T) {
+	confident := func(provider string) *metadataMatch {
+		return &metadataMatch{provider: provider, extId: "1", confidence: 0.9}
+	}
+	unsure := func(provider string) *metadataMatch {
+		return &metadataMatch{provider: provider, extId: "2", confidence: 0.4}
+	}
+
+	tests := []struct {
+		name      string
+		first     fakeProvider
+		second    fakeProvider
+		wantAsked []string
+		wantIds   []string
+	}{
+		{
+			name:      "confident match",
+			first:     fakeProvider{match: confident("first")},
+			second:    fakeProvider{match: confident("second")},
+			wantAsked: []string{"first"},
+			wantIds:   []string{"first"},
+		},
+		{
+			name:      "failure",
+			first:     fakeProvider{err: errors.New("api changed")},
+			second:    fakeProvider{match: confident("second")},
+			wantAsked: []string{"first", "second"},
+			wantIds:   []string{"second"},
+		},
+		{
+			name:      "no match",
+			first:     fakeProvider{},
+			second:    fakeProvider{match: confident("second")},
+			wantAsked: []string{"first", "second"},
+			wantIds:   []string{"second"},
+		},
+		{
+			name:      "unsure match",
+			first:     fakeProvider{match: unsure("first")},
+			second:    fakeProvider{match: unsure("second")},
+			wantAsked: []string{"first", "second"},
+			wantIds:   []string{"first", "second"},
+		},
+	}
+
+	for _, test := range tests {
+		dbPtr := openDb(filepath.Join(t.TempDir(), "movies.db"))
+		defer dbPtr.Close()
+
+		asked := []string{}
+		test.first.providerName, test.first.asked = "first", &asked
+		test.second.providerName, test.second.asked = "second", &asked
+
+		movieInfoPtr := &movieInfo{extIds: map[string]extId{}}
+		job := lookupJob{
+			title:        "DIUNA",
+			movieInfoPtr: movieInfoPtr,
+			providers:    []metadataProvider{test.first, test.second},
+		}
+		lookupMovie(job, http.DefaultClient, dbPtr)
+
+		if !slices.Equal(asked, test.wantAsked) {
+			t.Errorf("%s: asked %v, want %v", test.name, asked, test.wantAsked)
+		}
+		for _, provider := range test.wantIds {
+			if _, ok := movieInfoPtr.extIds[provider]; !ok {
+				t.Errorf("%s: no %s id", test.name, provider)
+			}
+		}
+		if len(movieInfoPtr.extIds) != len(test.wantIds) {
+			t.Errorf("%s: ids %v, want ones from %v", test.name, movieInfoPtr.extIds, test.wantIds)
+		}
+	}
+}
+
+func TestProvidersToLookup(t *testing.T) {
+	asked := []string{}
+	first := fakeProvider{providerName: "first", asked: &asked}
+	second := fakeProvider{providerName: "second", asked: &asked}
+	third := fakeProvider{providerName: "third", asked: &asked}
+
+	previousProviders := metadataProviders
+	metadataProviders = []metadataProvider{first, second, third}
+	defer func() { metadataProviders = previousProviders }()
+
+	confident := extId{id: "1", confidence: sql.NullFloat64{Float64: 0.9, Valid: true}}
+	unsure := extId{id: "2", confidence: sql.NullFloat64{Float64: 0.4, Valid: true}}
+	untracked := extId{id: "3"}
+
+	tests := []struct {
+		name   string
+		extIds map[string]extId
+		want   []string
+	}{
+		{"never looked up", map[string]extId{}, []string{"first", "second", "third"}},
+		{"confident first", map[string]extId{"first": confident}, []string{}},
+		{"confident second", map[string]extId{"first": unsure, "second": confident}, []string{}},
+		{"unsure first", map[string]extId{"first": unsure}, []string{"second", "third"}},
+		{"untracked first", map[string]extId{"first": untracked}, []string{"first", "second", "third"}},
+	}
+
+	for _, test := range tests {
+		names := []string{}
+		for _, provider := range providersToLookup(&movieInfo{extIds: test.extIds}) {
+			names = append(names, provider.name())
+		}
+		if !slices.Equal(names, test.want) {
+			t.Errorf("%s: %v, want %v", test.name, names, test.want)
+		}
+	}
+}
+
+func TestApplyMatchesKeepsOnlyConfidentMetadata(t *testing.T) {
+	dbPtr := openDb(filepath.Join(t.TempDir(), "movies.db"))
+	defer dbPtr.Close()
+	if _, err := dbPtr.Exec(`INSERT INTO movies (title) VALUES ('DIUNA');`); err != nil {
+		t.Fatal(err)
+	}
+
+	movieInfoPtr := &movieInfo{
+		extIds: map[string]extId{},
+		// as given by the cinema
+		metadata: movieMetadata{durationMin: 166, ageRating: "13"},
+	}
+	matches := []*metadataMatch{
+		{
+			provider:       "filmweb",
+			extId:          "Diuna-2021-1",
+			secondaryTitle: "Dune",
+			confidence:     0.5,
+			metadata:       movieMetadata{year: 2021, rating: 7.6, genres: []string{"Sci-Fi"}, kind: "serial"},
+		},
+		{
+			provider:   "tmdb",
+			extId:      "693134",
+			confidence: 0.9,
+			metadata:   movieMetadata{year: 2024, durationMin: 167, director: "Denis Villeneuve"},
+		},
+	}
+	applyMatches("DIUNA", movieInfoPtr, matches, dbPtr)
+
+	want := movieMetadata{year: 2024, durationMin: 167, director: "Denis Villeneuve", ageRating: "13"}
+	for name, got := range map[string]movieMetadata{
+		"applied": movieInfoPtr.metadata,
+		"stored":  loadMovieMetadata("DIUNA", dbPtr),
+	} {
+		if got.year != want.year || got.durationMin != want.durationMin || got.director != want.director ||
+			got.ageRating != want.ageRating || got.rating != 0 || len(got.genres) != 0 || got.kind != "" {
+			t.Errorf("%s metadata = %+v, want %+v", name, got, want)
+		}
+	}
+	if movieInfoPtr.secondaryTitle != "" {
+		t.Errorf("secondary title = %q, want none", movieInfoPtr.secondaryTitle)
+	}
+	if e, ok := movieInfoPtr.extIds["filmweb"]; !ok || e.isConfident() {
+		t.Errorf("unsure filmweb id = %+v, want it kept as unsure", e)
+	}
+}
+
+func TestForgetUnsureMetadata(t *testing.T) {
+	dbPtr := openDb(filepath.Join(t.TempDir(), "movies.db"))
+	defer dbPtr.Close()
+
+	_, err := dbPtr.Exec(`
+		INSERT INTO movies (title, secondary_title, year, rating, kind, age_rating)
+			VALUES
+				('UNSURE', 'Other', 1999, 5.5, 'serial', '13'),
+				('CONFIDENT', 'Dune', 2021, 7.6, NULL, '13'),
+				('UNTRACKED', 'Old', 2001, 6.1, NULL, NULL),
+				('NOT LOOKED UP', NULL, 2024, NULL, NULL, '16');
+		INSERT INTO movie_ext_ids (title, provider, ext_id, confidence)
+			VALUES
+				('UNSURE', 'filmweb', 'a', 0.4),
+				('CONFIDENT', 'filmweb', 'b', 0.4),
+				('CONFIDENT', 'tmdb', 'c', 0.9),
+				('UNTRACKED', 'filmweb', 'd', NULL);
+		INSERT INTO movie_genres (title, genre, position)
+			VALUES ('UNSURE', 'Serial', 0), ('CONFIDENT', 'Sci-Fi', 0);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := dbPtr.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := forgetUnsureMetadata(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"UNSURE": 0, "CONFIDENT": 2021, "UNTRACKED": 2001, "NOT LOOKED UP": 2024}
+	for title, wantYear := range want {
+		metadata := loadMovieMetadata(title, dbPtr)
+		if metadata.year != wantYear {
+			t.Errorf("%s: year = %d, want %d", title, metadata.year, wantYear)
+		}
+	}
+
+	unsure := loadMovieMetadata("UNSURE", dbPtr)
+	if unsure.rating != 0 || unsure.kind != "" || len(unsure.genres) != 0 || unsure.ageRating != "13" {
+		t.Errorf("UNSURE metadata = %+v, want only the age rating", unsure)
+	}
+	if confident := loadMovieMetadata("CONFIDENT", dbPtr); len(confident.genres) != 1 {
+		t.Errorf("CONFIDENT genres = %v, want them kept", confident.genres)
+	}
+}
@@ -2,20 +2,16 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
-	"log"
+	"maps"
 	"net/http"
-	"net/url"
 	"os"
 	"regexp"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"golang.org/x/text/collate"
@@ -23,15 +19,10 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-var excludedByKeywords = [...]string{
-	"UKRAINIAN", "UKRAIŃSKI",
-	"DLA OSÓB", "KLUB SENIORA", "DKF KROPKA DLA DZIECI",
-}
-
 // TODO properly remove punctuation?
 var removedKeywords = [...]string{
 	"2D", "3D", "DUBBING PL", "DUBBING", "NAPISY",
-	"TANI WTOREK", "DKF KROPKA", "DKF PEŁNA SALA",
+	"TANI WTOREK",
 	"PRZEDPREMIERA", "ENG SUB", "POKAZ SPECJALNY Z DYSKUSJĄ",
 	"WERSJA REŻYSERSKA", "POKAZ SPECJALNY",
 	"POKAZ PRZEDPREMIEROWY", "WERSJA ORYGINALNA",
@@ -41,14 +32,8 @@ var removedKeywords = [...]string{
 var allPunctuationRegex = regexp.MustCompile(`\p{P}`)
 var multipleSpacesRegex = regexp.MustCompile(`[\s\p{Zs}]{2,}`)
 
-// TODO enums etc.
-var filmwebUrls = map[string]string{
-	"SearchStart":  "https://www.filmweb.pl/api/v1/search?query=",
-	"SearchEnd":    "&pageSize=1",
-	"PreviewStart": "https://www.filmweb.pl/api/v1/film/",
-	"PreviewEnd":   "/preview",
-	"FilmStart":    "https://www.filmweb.pl/film/",
-}
+// e.g. 'Nosferatu (1922)', which cinemas use to tell apart remakes
+var releaseYearRegex = regexp.MustCompile(`\(\s*((?:19|20)\d{2})\s*\)\s*$`)
 
 type timePeriod int
 
@@ -57,59 +42,110 @@ const (
 	Yesterday
 	LastWeek
 	Earlier
+	// not showing within the horizon yet, so not seen either
+	ComingSoon
 )
 
+const defaultComingSoonDays = 14
+
+// Everything a summary is made of, as filtered for its notifier.
+type summaryData struct {
+	periodToMovie  map[timePeriod]map[string]*movieInfo
+	titleToChanges map[string][]showingChange
+	lastChance     map[string]*movieInfo
+	gone           map[string]*movieInfo
+	events         map[string]*movieInfo
+	// only for the categories listed in their own sections
+	categoryToMovies map[eventCategory]map[string]*movieInfo
+	cinemaToReceived map[cinema]bool
+	anomalies        []anomaly
+}
+
 type movieInfo struct {
 	secondaryTitle string
-	filmwebId      string
+	extIds         map[string]extId
+	year           int
+	metadata       movieMetadata
 	showings       []showing
+	// the films of a double feature or marathon
+	components []string
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "doctor":
+			os.Exit(doctor(os.Args[2:]))
+		case "cinemas":
+			os.Exit(cinemasCommand(os.Args[2:]))
+		case "watch":
+			os.Exit(watchCommand(os.Args[2:]))
+		case "plan":
+			os.Exit(planCommand(os.Args[2:]))
+		}
+	}
+
 	originFlagPtr := flag.String("gotify-origin", "", "The Gotify origin \"scheme://authority\".")
 	gotifyTokenFlagPtr := flag.String("gotify-token", "", "The Gotify token.")
 	logFlagPtr := flag.Bool("log", false, "Determines if the result should be logged as a markdown file.")
+	providersFlagPtr := flag.String("metadata-providers", "filmweb", "External movie dbs to use, comma separated in order of preference (filmweb, tmdb).")
+	tmdbApiFlagPtr := flag.String("tmdb-api", tmdbDefaultApi, "Base URL of the TMDB-compatible API.")
+	tmdbTokenFlagPtr := flag.String("tmdb-token", "", "The TMDB API read access token.")
+	comingSoonFlagPtr := flag.Int("coming-soon-days", defaultComingSoonDays, "New movies whose first showing is further away than this many days are listed under COMING SOON.")
+	lastChanceFlagPtr := flag.Int("last-chance-days", defaultLastChanceDays, "Movies whose final showing is within this many days are listed under LAST CHANCE.")
+	cityFlagPtr := flag.String("city", defaultCity, "ID of the city from the cinema registry to gather the showings for.")
+	cinemasFlagPtr := flag.String("cinemas-config", "", "Path to the cinema registry, replacing the built-in one.")
+	scrapersFlagPtr := flag.String("scrapers", "", "Path to the scraped cinemas' definitions, replacing the built-in ones.")
+	notifiersFlagPtr := flag.String("notifiers", "", "Path to the definitions of additional notifiers, each with its own filter.")
+	adOffsetsFlagPtr := flag.String("ad-offsets", defaultAdOffsets, "Minutes of ads before the film by the cinema's source, for the estimated end times.")
+	icsFlagPtr := flag.String("ics", "", "Path to export the showings to as an iCalendar file.")
+	jsonFlagPtr := flag.String("json", "", "Path to export the showings to as JSON.")
 	flag.Parse()
 
-	dbPtr, err := sql.Open("sqlite", "./movies.db")
-	if err != nil {
+	if err := setupCinemas(*cinemasFlagPtr, *scrapersFlagPtr, *cityFlagPtr); err != nil {
 		panic(err)
 	}
-	defer dbPtr.Close()
-
-	_, err = dbPtr.Exec("PRAGMA journal_mode=WAL;")
-	if err != nil {
+	if err := setAdOffsets(*adOffsetsFlagPtr); err != nil {
 		panic(err)
 	}
-	// TODO temporary solution for DB access
-	_, err = dbPtr.Exec("PRAGMA busy_timeout=50000;")
-	if err != nil {
-		panic(err)
-	}
-	dbPtr.SetMaxOpenConns(1)
-
-	sqlCreate := `
-	CREATE TABLE IF NOT EXISTS movies (
-		title TEXT NOT NULL PRIMARY KEY,
-		first_seen TEXT NOT NULL,
-		last_seen TEXT NOT NULL,
-		secondary_title TEXT,
-		ext_db_id TEXT
-	);
-	`
-	_, err = dbPtr.Exec(sqlCreate)
-	if err != nil {
-		panic(err)
+
+	// the one given by the flags gets everything
+	notifiers := []notifier{{
+		GotifyOrigin: *originFlagPtr,
+		GotifyToken:  *gotifyTokenFlagPtr,
+		Log:          *logFlagPtr,
+		Ics:          *icsFlagPtr,
+		Json:         *jsonFlagPtr,
+	}}
+	notifiers[0].Filter.compile()
+	if *notifiersFlagPtr != "" {
+		configured, err := loadNotifiers(*notifiersFlagPtr)
+		if err != nil {
+			panic(err)
+		}
+		notifiers = append(notifiers, configured...)
 	}
 
+	metadataProviders =
+		newMetadataProviders(*providersFlagPtr, *tmdbApiFlagPtr, *tmdbTokenFlagPtr)
+
+	dbPtr := openDb("./movies.db")
+	defer dbPtr.Close()
+
 	answerCountdown := len(cinemasToScrape) + len(cinemasToFetch)
 	resultCh := make(chan result)
 
 	scrape(resultCh)
 	fetch(resultCh)
 
-	var receivedArr = [CINEMA_COUNT]bool{}
+	cinemaToReceived := map[cinema]bool{}
 	titleToShowings := map[string][]showing{}
+	titleToYear := map[string]int{}
+	titleToMetadata := map[string]movieMetadata{}
+	// double features and marathons, to the films they're made of
+	titleToComponents := map[string][]string{}
+	cinemaToCount := map[cinema]int{}
+	anomalies := []anomaly{}
 
 WaitForCinemas:
 	for {
@@ -121,47 +157,68 @@ WaitForCinemas:
 			break WaitForCinemas
 		}
 
-		receivedArr[result.cinema] = true
-		var lenT int
+		cinemaToReceived[result.cinema] = true
+		cinemaToCount[result.cinema] = 0
+		anomalies = append(anomalies, result.anomalies...)
+		var year int
 
 		for rawTitle, showings := range result.titleToShowings {
+			cinemaToCount[result.cinema] += len(showings)
 			title := strings.ToUpper(rawTitle)
 
-			for _, kw := range excludedByKeywords {
-				if strings.Contains(title, kw) {
-					goto skipMovie
+			categories, title := classifyTitle(title)
+			// split before the punctuation's gone, along with the separators
+			components := splitCombinedTitle(title)
+			if len(components) > 0 && !slices.Contains(categories, Marathon) {
+				categories = append(categories, Marathon)
+			}
+			if len(categories) > 0 {
+				for i := range showings {
+					showings[i].categories = append(showings[i].categories, categories...)
 				}
 			}
 
-			title = allPunctuationRegex.ReplaceAllString(title, " ")
+			title, year = normalizeTitle(title)
 
-			for _, kw := range removedKeywords {
-				title = strings.ReplaceAll(title, kw, "")
+			if title == "" {
+				anomalies = append(anomalies, anomaly{result.cinema, EmptyTitle, rawTitle})
+				goto skipMovie
 			}
 
-			title = multipleSpacesRegex.ReplaceAllString(title, " ")
-
-			title = strings.TrimSpace(title)
-
-			// remove any text in parentheses at the end like '(dubbing)'
-			lenT = len(title)
-			for title[lenT-1] == ')' && title[0] != '(' {
-				for i := range lenT {
-					if title[lenT-1-i] == '(' {
-						title = title[0 : lenT-1-i-1]
-						break
-					}
-				}
-				lenT = len(title)
-			}
-			title = strings.TrimSpace(title)
-
 			if showingsOld, ok := titleToShowings[title]; ok {
 				titleToShowings[title] = append(showingsOld, showings...)
 			} else {
 				titleToShowings[title] = showings
 			}
 
+			if metadata, ok := result.titleToMetadata[rawTitle]; ok {
+				titleToMetadata[title] = titleToMetadata[title].withFallback(metadata)
+				if year == 0 {
+					year = metadata.year
+				}
+			}
+
+			if year != 0 {
+				titleToYear[title] = year
+			}
+
+			// listed under each of its films too, so that they get linked
+			for _, component := range components {
+				componentTitle, componentYear := normalizeTitle(component)
+				if componentTitle == "" || componentTitle == title {
+					continue
+				}
+				for _, combinedShowing := range showings {
+					combinedShowing.categories = slices.Clone(combinedShowing.categories)
+					combinedShowing.combinedTitle = title
+					titleToShowings[componentTitle] = append(titleToShowings[componentTitle], combinedShowing)
+				}
+				if componentYear != 0 {
+					titleToYear[componentTitle] = componentYear
+				}
+				titleToComponents[title] = append(titleToComponents[title], componentTitle)
+			}
+
 		skipMovie:
 		}
 
@@ -178,70 +235,212 @@ WaitForCinemas:
 		})
 	}
 
-	periodToMovie := updateDbGetPeriodAggregate(titleToShowings, dbPtr)
+	anomalies = checkDataQuality(titleToShowings, cinemaToCount, anomalies, dbPtr)
+	previousTitleToShowings := loadPreviousShowings(dbPtr)
+	titleToChanges := diffShowings(titleToShowings, previousTitleToShowings, cinemaToReceived)
+	runId := recordRun(cinemaToCount, anomalies, dbPtr)
+	recordRunShowings(runId, titleToShowings, dbPtr)
 
-	summary := createSummary(periodToMovie, receivedArr)
+	periodToMovie := updateDbGetPeriodAggregate(titleToShowings, titleToYear, titleToMetadata, titleToComponents, *comingSoonFlagPtr, dbPtr)
 
-	if *originFlagPtr != "" && *gotifyTokenFlagPtr != "" {
-		postSummaryToGotify(summary, *originFlagPtr, *gotifyTokenFlagPtr)
+	// all of a new movie's showings are new anyway
+	for title := range periodToMovie[Today] {
+		delete(titleToChanges, title)
 	}
 
-	if *logFlagPtr {
-		logSummary(summary)
+	estimateEnds(periodToMovie)
+	events := extractEvents(periodToMovie)
+	// they're listed with all of their showings anyway
+	for title := range events {
+		delete(titleToChanges, title)
+	}
+	lastChance := findLastChance(periodToMovie, *lastChanceFlagPtr)
+	gone := findGone(previousTitleToShowings, titleToShowings, cinemaToReceived, dbPtr)
+
+	data := summaryData{
+		periodToMovie:    periodToMovie,
+		titleToChanges:   titleToChanges,
+		lastChance:       lastChance,
+		gone:             gone,
+		events:           events,
+		cinemaToReceived: cinemaToReceived,
+		anomalies:        anomalies,
+	}
+	watchlist := loadWatchlist(dbPtr)
+
+	for _, notifier := range notifiers {
+		notify(notifier, notifier.Filter.apply(data), watchlist)
 	}
 }
 
-func updateDbGetPeriodAggregate(titleToShowings map[string][]showing, dbPtr *sql.DB) map[timePeriod]map[string]*movieInfo {
+func notify(notifier notifier, data summaryData, watchlist []watchEntry) {
+	summary := createSummary(data)
+
+	if notifier.GotifyOrigin != "" && notifier.GotifyToken != "" {
+		postSummaryToGotify(summary, notifier.GotifyOrigin, notifier.GotifyToken)
+
+		// watched movies get their own notification, so they don't get lost
+		watchAlerts := findWatchAlerts(watchlist, data)
+		if len(watchAlerts) > 0 {
+			alertTitle := fmt.Sprintf("%s: watchlist", currentCity.Name)
+			postToGotify(alertTitle, createWatchAlertMessage(watchAlerts),
+				watchAlertPriority, notifier.GotifyOrigin, notifier.GotifyToken)
+		}
+	}
+
+	if notifier.Log {
+		logSummary(summary, notifier.Name)
+	}
+
+	if notifier.Ics != "" {
+		if err := exportIcs(notifier.Ics, data); err != nil {
+			panic(err)
+		}
+	}
+	if notifier.Json != "" {
+		if err := exportJson(notifier.Json, data); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Upper case title stripped of punctuation, keywords like "napisy" and any
+// trailing parentheses, along with the release year if it's given in it.
+func normalizeTitle(title string) (string, int) {
+	year := 0
+	if match := releaseYearRegex.FindStringSubmatch(title); match != nil {
+		year, _ = strconv.Atoi(match[1])
+		title = title[:len(title)-len(match[0])]
+	}
+
+	title = allPunctuationRegex.ReplaceAllString(title, " ")
+
+	for _, kw := range removedKeywords {
+		title = strings.ReplaceAll(title, kw, "")
+	}
+
+	title = multipleSpacesRegex.ReplaceAllString(title, " ")
+
+	title = strings.TrimSpace(title)
+
+	// remove any text in parentheses at the end like '(dubbing)'
+	lenT := len(title)
+	for lenT > 0 && title[lenT-1] == ')' && title[0] != '(' {
+		for i := range lenT {
+			if title[lenT-1-i] == '(' {
+				title = title[0 : lenT-1-i-1]
+				break
+			}
+		}
+		lenT = len(title)
+	}
+	title = strings.TrimSpace(title)
+
+	return title, year
+}
+
+// Expects the showings to be sorted already.
+func updateDbGetPeriodAggregate(titleToShowings map[string][]showing, titleToYear map[string]int, titleToMetadata map[string]movieMetadata, titleToComponents map[string][]string, comingSoonDays int, dbPtr *sql.DB) map[timePeriod]map[string]*movieInfo {
 	periodToMovie := map[timePeriod]map[string]*movieInfo{}
 	periodToMovie[Today] = map[string]*movieInfo{}
 	periodToMovie[Yesterday] = map[string]*movieInfo{}
 	periodToMovie[LastWeek] = map[string]*movieInfo{}
 	periodToMovie[Earlier] = map[string]*movieInfo{}
+	periodToMovie[ComingSoon] = map[string]*movieInfo{}
 
-	var queryUpdateWg sync.WaitGroup
+	comingSoonHorizon := time.Now().AddDate(0, 0, comingSoonDays)
 
-	client := &http.Client{}
+	var lookupQueue []lookupJob
 
 	for title, showings := range titleToShowings {
+		if len(showings) == 0 {
+			// nothing to list, nor a first showing to tell when it starts
+			continue
+		}
+
+		movieInfoPtr := &movieInfo{
+			extIds:     map[string]extId{},
+			showings:   showings,
+			year:       titleToYear[title],
+			components: titleToComponents[title],
+		}
+
+		// only for the new ones, as the known ones have to keep being seen so
+		// that they don't turn new again
+		var sighted bool
+		sqlExists := `
+			SELECT EXISTS (
+				SELECT 1
+					FROM movie_sightings
+					WHERE city = ? AND title = ?
+			);
+		`
+		if err := dbPtr.QueryRow(sqlExists, currentCity.Id, title).Scan(&sighted); err != nil {
+			panic(err)
+		}
+
+		if !sighted && showings[0].time.After(comingSoonHorizon) {
+			// it's only seen once it starts, so that it's new then
+			periodToMovie[ComingSoon][title] = movieInfoPtr
+
+			sqlInsert := `
+				INSERT INTO movies (title)
+					VALUES(?)
+					ON CONFLICT DO NOTHING;
+			`
+			_, err := dbPtr.Exec(sqlInsert, title)
+			if err != nil {
+				panic(err)
+			}
+
+			lookupQueue = append(lookupQueue, loadKnownMovie(title, movieInfoPtr, titleToMetadata, dbPtr)...)
+			continue
+		}
+
 		sqlSelect := `
-			SELECT secondary_title, ext_db_id, first_seen, last_seen
-				FROM movies
-				WHERE title = ?;
+			SELECT first_seen, last_seen
+				FROM movie_sightings
+				WHERE city = ? AND title = ?;
 		`
-		rows, err := dbPtr.Query(sqlSelect, title)
+		rows, err := dbPtr.Query(sqlSelect, currentCity.Id, title)
 		if err != nil {
 			panic(err)
 		}
 
-		movieInfoPtr := &movieInfo{showings: showings}
-
 		today := time.Now()
 		todayStr :=
 			fmt.Sprintf("%d-%02d-%02d",
 				today.Year(), today.Month(), today.Day())
 
 		if !rows.Next() {
-			// no db entry -> add it and treat it as a new movie from today
+			rows.Close()
+
+			// not seen in this city -> add it and treat it as a new movie from today
 			periodToMovie[Today][title] = movieInfoPtr
 
 			sqlInsert := `
-				INSERT INTO movies
-					(title, first_seen, last_seen)
-					VALUES(?, ?, ?);
+				INSERT INTO movie_sightings
+					(city, title, first_seen, last_seen)
+					VALUES(?, ?, ?, ?);
 			`
-			_, err = dbPtr.Exec(sqlInsert, title, todayStr, todayStr)
+			_, err = dbPtr.Exec(sqlInsert, currentCity.Id, title, todayStr, todayStr)
 			if err != nil {
 				panic(err)
 			}
 
-			queryUpdateWg.Go(func() {
-				searchAndUpdateMovie(title, client, movieInfoPtr, dbPtr)
-			})
+			// might've been seen in another city, along with its metadata
+			sqlInsert = `
+				INSERT INTO movies (title)
+					VALUES(?)
+					ON CONFLICT DO NOTHING;
+			`
+			_, err = dbPtr.Exec(sqlInsert, title)
+			if err != nil {
+				panic(err)
+			}
 		} else {
 			var firstSeenStr, lastSeenStr string
-			var secondaryTitle, filmwebId sql.NullString
-			err :=
-				rows.Scan(&secondaryTitle, &filmwebId, &firstSeenStr, &lastSeenStr)
+			err := rows.Scan(&firstSeenStr, &lastSeenStr)
 
 			if err != nil {
 				panic(err)
@@ -252,10 +451,6 @@ func updateDbGetPeriodAggregate(titleToShowings map[string][]showing, dbPtr *sql
 			today, _ := time.Parse(time.DateOnly, todayStr)
 			lastSeenHourDiff := today.Sub(lastSeen).Hours()
 
-			// later will be overridden by a goroutine call to external movie db if needed
-			movieInfoPtr.secondaryTitle = secondaryTitle.String
-			movieInfoPtr.filmwebId = filmwebId.String
-
 			if lastSeenHourDiff > 25 {
 				// haven't appeared in any repertoires in a while -> treat it as
 				// a 'new' movie from today - all assuming it's ran daily
@@ -263,11 +458,11 @@ func updateDbGetPeriodAggregate(titleToShowings map[string][]showing, dbPtr *sql
 				periodToMovie[Today][title] = movieInfoPtr
 
 				sqlUpdate := `
-					UPDATE movies
+					UPDATE movie_sightings
 						SET first_seen = ?, last_seen = ?
-						WHERE title = ?;
+						WHERE city = ? AND title = ?;
 				`
-				_, err = dbPtr.Exec(sqlUpdate, todayStr, todayStr, title)
+				_, err = dbPtr.Exec(sqlUpdate, todayStr, todayStr, currentCity.Id, title)
 				if err != nil {
 					panic(err)
 				}
@@ -288,89 +483,177 @@ func updateDbGetPeriodAggregate(titleToShowings map[string][]showing, dbPtr *sql
 				periodToMovie[period][title] = movieInfoPtr
 
 				sqlUpdate := `
-					UPDATE movies
+					UPDATE movie_sightings
 						SET last_seen = ?
-						WHERE title = ?;
+						WHERE city = ? AND title = ?;
 				`
-				_, err = dbPtr.Exec(sqlUpdate, todayStr, title)
+				_, err = dbPtr.Exec(sqlUpdate, todayStr, currentCity.Id, title)
 				if err != nil {
 					panic(err)
 				}
 			}
-
-			if !secondaryTitle.Valid {
-				queryUpdateWg.Go(func() {
-					searchAndUpdateMovie(title, client, movieInfoPtr, dbPtr)
-				})
-			}
 		}
+
+		lookupQueue = append(lookupQueue, loadKnownMovie(title, movieInfoPtr, titleToMetadata, dbPtr)...)
 	}
 
-	queryUpdateWg.Wait()
+	lookupMovies(lookupQueue, dbPtr)
 
 	return periodToMovie
 }
 
-func createSummary(periodToMovie map[timePeriod]map[string]*movieInfo, receivedArr [CINEMA_COUNT]bool) string {
+// Fills in whatever's known about the movie, returning a lookup job for
+// whatever isn't, if anything.
+func loadKnownMovie(title string, movieInfoPtr *movieInfo, titleToMetadata map[string]movieMetadata, dbPtr *sql.DB) []lookupJob {
+	// later will be overridden by a goroutine call to external movie db if needed
+	var secondaryTitle sql.NullString
+	err := dbPtr.QueryRow(`SELECT secondary_title FROM movies WHERE title = ?;`, title).
+		Scan(&secondaryTitle)
+	if err != nil {
+		panic(err)
+	}
+	movieInfoPtr.secondaryTitle = secondaryTitle.String
+	movieInfoPtr.extIds = loadExtIds(title, dbPtr)
+	// what the cinemas say only fills the gaps in what's been looked up
+	movieInfoPtr.metadata =
+		loadMovieMetadata(title, dbPtr).withFallback(titleToMetadata[title])
+
+	// the ones recognised by their titles wouldn't be found anyway, and
+	// the films making up the combined ones are looked up on their own
+	if isEvent(movieInfoPtr) || len(movieInfoPtr.components) > 0 {
+		return nil
+	}
+
+	if providers := providersToLookup(movieInfoPtr); len(providers) > 0 {
+		return []lookupJob{{title, movieInfoPtr, providers}}
+	}
+	return nil
+}
+
+func createSummary(data summaryData) string {
 	var sb strings.Builder
 
 	// gotify android app markdown renderer needs '\n' for a newline it seems
-	if len(periodToMovie[Today]) > 0 {
+	if len(data.periodToMovie[Today]) > 0 {
 		sb.WriteString(`# **TODAY**  \n`)
-		writeMovies(&sb, periodToMovie[Today])
+		writeMovies(&sb, data.periodToMovie[Today])
+	}
+
+	if len(data.titleToChanges) > 0 {
+		titleToMovie := map[string]*movieInfo{}
+		for _, movieMap := range data.periodToMovie {
+			maps.Copy(titleToMovie, movieMap)
+		}
+
+		sb.WriteString(`# **NEW SCREENINGS**  \n`)
+		writeChanges(&sb, data.titleToChanges, titleToMovie)
 	}
 
-	if len(periodToMovie[Yesterday]) > 0 {
+	if len(data.lastChance) > 0 {
+		sb.WriteString(`# **LAST CHANCE**  \n`)
+		writeLastChance(&sb, data.lastChance)
+		sb.WriteString(`  \n`)
+	}
+
+	if len(data.periodToMovie[Yesterday]) > 0 {
 		sb.WriteString(`# **YESTERDAY**  \n`)
-		writeMovies(&sb, periodToMovie[Yesterday])
+		writeMovies(&sb, data.periodToMovie[Yesterday])
 	}
 
-	if len(periodToMovie[LastWeek]) > 0 {
+	if len(data.periodToMovie[LastWeek]) > 0 {
 		sb.WriteString(`# **LAST WEEK**  \n`)
-		writeMovies(&sb, periodToMovie[LastWeek])
+		writeMovies(&sb, data.periodToMovie[LastWeek])
 	}
 
-	if len(periodToMovie[Earlier]) > 0 {
+	if len(data.periodToMovie[Earlier]) > 0 {
 		sb.WriteString(`# **EARLIER**  \n`)
-		writeMovies(&sb, periodToMovie[Earlier])
+		writeMovies(&sb, data.periodToMovie[Earlier])
+	}
+
+	if len(data.periodToMovie[ComingSoon]) > 0 {
+		sb.WriteString(`# **COMING SOON**  \n`)
+		writeComingSoon(&sb, data.periodToMovie[ComingSoon])
+		sb.WriteString(`  \n`)
+	}
+
+	if len(data.events) > 0 {
+		sb.WriteString(`# **EVENTS**  \n`)
+		writeEvents(&sb, data.events)
+	}
+
+	for _, category := range eventCategories {
+		if len(data.categoryToMovies[category]) > 0 {
+			sb.WriteString(fmt.Sprintf(`# **%s**  \n`, eventCategoryHeadings[category]))
+			writeMovies(&sb, data.categoryToMovies[category])
+		}
 	}
 
+	if len(data.gone) > 0 {
+		sb.WriteString(`# **GONE**  \n`)
+		writeGone(&sb, data.gone)
+		sb.WriteString(`  \n`)
+	}
+
+	// the ones coming soon aren't showing yet
 	totalCount := 0
-	for _, movieMap := range periodToMovie {
-		totalCount += len(movieMap)
+	for period, movieMap := range data.periodToMovie {
+		if period != ComingSoon {
+			totalCount += len(movieMap)
+		}
 	}
 
 	totalLine := fmt.Sprintf(`**TOTAL: %d**  \n`, totalCount)
 	sb.WriteString(totalLine)
 
-	if slices.Contains(receivedArr[:], false) {
+	notReceived := []cinema{}
+	for _, cinema := range enabledCinemas() {
+		if !data.cinemaToReceived[cinema] {
+			notReceived = append(notReceived, cinema)
+		}
+	}
+	if len(notReceived) > 0 {
 		sb.WriteString(`RESULTS NOT RECEIVED FROM:  \n`)
-		for cinemaIndex, received := range receivedArr {
-			if !received {
-				cinemaLine := fmt.Sprintf(`%s  \n`, cinema(cinemaIndex))
-				sb.WriteString(cinemaLine)
-			}
+		for _, cinema := range notReceived {
+			cinemaLine := fmt.Sprintf(`%s  \n`, cinema)
+			sb.WriteString(cinemaLine)
 		}
 	}
 
+	if len(data.anomalies) > 0 {
+		sb.WriteString(`WARNINGS:  \n`)
+		writeWarnings(&sb, data.anomalies)
+	}
+
 	return sb.String()
 }
 
 func postSummaryToGotify(summary string, origin string, token string) {
 	today := time.Now()
 	todayStr :=
-		fmt.Sprintf("%02d/%02d/%d",
+		fmt.Sprintf("%s %02d/%02d/%d", currentCity.Name,
 			today.Day(), today.Month(), today.Year())
 
+	postToGotify(todayStr, summary, 0, origin, token)
+}
+
+// The message is markdown, with the newlines already escaped. A zero
+// priority leaves it up to the app's default.
+func postToGotify(title string, message string, priority int, origin string, token string) {
+	priorityField := ""
+	if priority > 0 {
+		priorityField = fmt.Sprintf(`"priority": %d,`, priority)
+	}
+
 	reqBodyStr := fmt.Sprintf(`{
 			"title": "%s",
 			"message": "%s",
+			%s
 			"extras": {
 				"client::display": {
 					"contentType": "text/markdown"
 				}
 			}
-		}`, todayStr, summary)
+		}`, title, message, priorityField)
 	reqBody := strings.NewReader(reqBodyStr)
 
 	gotifyUrl := fmt.Sprintf("%s/message?token=%s", origin, token)
@@ -378,13 +661,22 @@ func postSummaryToGotify(summary string, origin string, token string) {
 	http.Post(gotifyUrl, "application/json", reqBody)
 }
 
-func logSummary(summary string) {
+// The unnamed notifier's summary goes to the file without a suffix.
+func logSummary(summary string, notifierName string) {
 	today := time.Now()
 	todayStr :=
 		fmt.Sprintf("%d-%02d-%02d",
 			today.Year(), today.Month(), today.Day())
 
-	filepath := fmt.Sprintf("%s.md", todayStr)
+	// each city's summary gets its own file, the default one's keeps the old name
+	filepath := todayStr
+	if currentCity.Id != defaultCity {
+		filepath += "-" + currentCity.Id
+	}
+	if notifierName != "" {
+		filepath += "-" + notifierName
+	}
+	filepath += ".md"
 	file, err := os.Create(filepath)
 	if err != nil {
 		panic(err)
@@ -392,114 +684,11 @@ func logSummary(summary string) {
 	defer file.Close()
 
 	summary = strings.ReplaceAll(summary, `\n`, `<br>`)
+	file.WriteString(fmt.Sprintf("# %s<br>", currentCity.Name))
 	file.WriteString(summary)
 }
 
-func searchAndUpdateMovie(title string, client *http.Client, movieInfoPtr *movieInfo, dbPtr *sql.DB) {
-	titleQuery := url.QueryEscape(title)
-	url := filmwebUrls["SearchStart"] + titleQuery + filmwebUrls["SearchEnd"]
-	req, _ := http.NewRequest("GET", url, nil)
-
-	res, err := client.Do(req)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	defer res.Body.Close()
-
-	var body map[string]any
-	bodyBytes, _ := io.ReadAll(res.Body)
-	if err := json.Unmarshal(bodyBytes, &body); err != nil {
-		log.Println(err)
-		return
-	}
-
-	searchHits := body["searchHits"].([]any)
-	if len(searchHits) == 0 {
-		return
-	}
-	searchHit := searchHits[0].(map[string]any)
-
-	hitType := searchHit["type"].(string)
-	if hitType != "film" {
-		return
-	}
-
-	id := strconv.Itoa(int(searchHit["id"].(float64)))
-
-	url = filmwebUrls["PreviewStart"] + id + filmwebUrls["PreviewEnd"]
-	req, _ = http.NewRequest("GET", url, nil)
-
-	res, err = client.Do(req)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	defer res.Body.Close()
-
-	bodyBytes, _ = io.ReadAll(res.Body)
-	if err := json.Unmarshal(bodyBytes, &body); err != nil {
-		log.Println(err)
-		return
-	}
-
-	var filmwebTitle string
-	secondaryTitle := ""
-	if titleRaw, exists := body["title"]; exists {
-		titleMap := titleRaw.(map[string]any)
-		filmwebTitle = titleMap["title"].(string)
-
-		if internationalTitleRaw, exists := body["internationalTitle"]; exists {
-			titleMap := internationalTitleRaw.(map[string]any)
-			secondaryTitle = titleMap["title"].(string)
-		} else if originalTitleRaw, exists := body["originalTitle"]; exists {
-			titleMap := originalTitleRaw.(map[string]any)
-			secondaryTitle = titleMap["title"].(string)
-		}
-	} else {
-		// polish movies usually only have originalTitle it seems
-		titleMap := body["originalTitle"].(map[string]any)
-		filmwebTitle = titleMap["title"].(string)
-	}
-
-	year := strconv.Itoa(int(body["year"].(float64)))
-
-	movieInfoPtr.secondaryTitle = secondaryTitle
-	movieInfoPtr.filmwebId =
-		createFullFilmwebId(filmwebTitle, year, id)
-
-	sqlUpdate := `
-			UPDATE movies
-				SET secondary_title = ?, ext_db_id = ?
-				WHERE title = ?;
-		`
-	_, err =
-		dbPtr.Exec(sqlUpdate, movieInfoPtr.secondaryTitle,
-			movieInfoPtr.filmwebId, title)
-
-	if err != nil {
-		panic(err)
-	}
-
-}
-
-// Based on the following JS funs from filmweb.pl,
-// where type is assumed to be "film":
-//
-//	function u({type: e, title: r, year: n, id: i}) {
-//	    return `${t()}/${e}/${s(r)}-${n}-${i}`
-//	}
-//
-//	function s(e="") {
-//	    return encodeURIComponent(e.replace(/[?!;/#\s]/g, " ").trim()).replace(/'/g, "%27").replace(/\+/g, "%2B").
-//			        replace(/\(/g, "%28").replace(/\)/g, "%29").replace(/%20/g, "+").replace(/\+{2,}/g, "+")
-//	}
-func createFullFilmwebId(rawTitle string, year string, id string) string {
-	title := url.QueryEscape(rawTitle)
-	return fmt.Sprintf("%s-%s-%s", title, year, id)
-}
-
-func writeMovies(sb *strings.Builder, titleMap map[string]*movieInfo) {
+func sortedTitles[V any](titleMap map[string]V) []string {
 	titles := make([]string, len(titleMap))
 	i := 0
 	for title := range titleMap {
@@ -508,13 +697,15 @@ func writeMovies(sb *strings.Builder, titleMap map[string]*movieInfo) {
 	}
 	collator := collate.New(language.Polish)
 	collator.SortStrings(titles)
+	return titles
+}
 
+func writeMovies(sb *strings.Builder, titleMap map[string]*movieInfo) {
 	var lastDate time.Time
-	for _, title := range titles {
+	for _, title := range sortedTitles(titleMap) {
 		titleFormatted := strings.Replace(title, "\"", "\\\"", -1)
 
-		if titleMap[title].filmwebId != "" {
-			movieUrl := filmwebUrls["FilmStart"] + titleMap[title].filmwebId
+		if movieUrl := movieLink(titleMap[title]); movieUrl != "" {
 			titleLine := fmt.Sprintf(`## [%s](%s)`, titleFormatted, movieUrl)
 			sb.WriteString(titleLine)
 
@@ -527,6 +718,12 @@ func writeMovies(sb *strings.Builder, titleMap map[string]*movieInfo) {
 			sb.WriteString(titleLine)
 		}
 
+		// whatever's known, even if it's only from the cinema
+		if metadataStr := titleMap[title].metadata.String(); metadataStr != "" {
+			metadataLine := fmt.Sprintf(`\n*%s*`, metadataStr)
+			sb.WriteString(metadataLine)
+		}
+
 		lastDate = time.Time{}
 		for _, showing := range titleMap[title].showings {
 			dateTime := showing.time
@@ -544,13 +741,19 @@ func writeMovies(sb *strings.Builder, titleMap map[string]*movieInfo) {
 			}
 
 			showingLine :=
-				fmt.Sprintf(`[%s](%s)  [%02d:%02d](%s)  \n`,
+				fmt.Sprintf(`[%s](%s)  [%02d:%02d](%s)%s`,
 					showing.cinema.String(),
-					websites[showing.cinema],
+					showing.cinema.info().Website,
 					dateTime.Hour(),
 					dateTime.Minute(),
-					showing.url)
+					showing.url,
+					formatEnd(showing))
 			sb.WriteString(showingLine)
+
+			if detailsStr := showing.details(); detailsStr != "" {
+				sb.WriteString(fmt.Sprintf(`  *%s*`, detailsStr))
+			}
+			sb.WriteString(`  \n`)
 		}
 
 		sb.WriteString(`  \n`)
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComingSoonOnlyForNewMovies(t *testing.T) {
+	dbPtr := openDb(filepath.Join(t.TempDir(), "movies.db"))
+	defer dbPtr.Close()
+
+	today := time.Now().Format(time.DateOnly)
+	_, err := dbPtr.Exec(`
+		INSERT INTO movies (title) VALUES ('ZNANY');
+		INSERT INTO movie_sightings (city, title, first_seen, last_seen)
+			VALUES (?, 'ZNANY', '2020-01-01', ?);
+	`, currentCity.Id, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	farAway := []showing{{cinema: "Kijow", time: time.Now().AddDate(0, 1, 0)}}
+	titleToShowings := map[string][]showing{
+		"ZNANY": farAway,
+		"NOWY":  farAway,
+	}
+	periodToMovie := updateDbGetPeriodAggregate(titleToShowings, map[string]int{},
+		map[string]movieMetadata{}, map[string][]string{}, 14, dbPtr)
+
+	if _, ok := periodToMovie[ComingSoon]["NOWY"]; !ok {
+		t.Error("NOWY isn't coming soon")
+	}
+	if _, ok := periodToMovie[ComingSoon]["ZNANY"]; ok {
+		t.Error("ZNANY, which is already known, is coming soon")
+	}
+	if _, ok := periodToMovie[Earlier]["ZNANY"]; !ok {
+		t.Error("ZNANY isn't listed as an earlier movie")
+	}
+
+	var lastSeen string
+	err = dbPtr.QueryRow(`SELECT last_seen FROM movie_sightings WHERE title = 'ZNANY';`).Scan(&lastSeen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastSeen != today {
+		t.Errorf("ZNANY last seen %s, want %s", lastSeen, today)
+	}
+
+	var sightings int
+	err = dbPtr.QueryRow(`SELECT COUNT(*) FROM movie_sightings WHERE title = 'NOWY';`).Scan(&sightings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sightings != 0 {
+		t.Error("NOWY is seen before it starts")
+	}
+
+	summary := createSummary(summaryData{periodToMovie: periodToMovie})
+	if !strings.Contains(summary, "**TOTAL: 1**") {
+		t.Errorf("summary doesn't count only the showing movie: %s", summary)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type movieMetadata struct {
+	year        int
+	genres      []string
+	countries   []string
+	director    string
+	durationMin int
+	rating      float64
+	posterUrl   string
+	// as given by the cinema, e.g. "15", "B/O"
+	ageRating string
+	// what the movie db lists it as when it's not a film, e.g. "tvshow"
+	kind string
+}
+
+// e.g. "Dramat, 2h 14m, 15+, ★7.4", with any unknown parts left out
+func (m movieMetadata) String() string {
+	parts := []string{}
+
+	if len(m.genres) > 0 {
+		parts = append(parts, strings.Join(m.genres, ", "))
+	}
+
+	if m.durationMin > 0 {
+		parts = append(parts, formatDuration(m.durationMin))
+	}
+
+	if m.ageRating != "" {
+		parts = append(parts, formatAgeRating(m.ageRating))
+	}
+
+	if m.rating > 0 {
+		parts = append(parts, fmt.Sprintf("★%.1f", m.rating))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Fills in whatever's missing from the other metadata.
+func (m movieMetadata) withFallback(other movieMetadata) movieMetadata {
+	if m.year == 0 {
+		m.year = other.year
+	}
+	if len(m.genres) == 0 {
+		m.genres = other.genres
+	}
+	if len(m.countries) == 0 {
+		m.countries = other.countries
+	}
+	if m.director == "" {
+		m.director = other.director
+	}
+	if m.durationMin == 0 {
+		m.durationMin = other.durationMin
+	}
+	if m.rating == 0 {
+		m.rating = other.rating
+	}
+	if m.posterUrl == "" {
+		m.posterUrl = other.posterUrl
+	}
+	if m.ageRating == "" {
+		m.ageRating = other.ageRating
+	}
+	if m.kind == "" {
+		m.kind = other.kind
+	}
+
+	return m
+}
+
+func formatDuration(durationMin int) string {
+	if durationMin < 60 {
+		return fmt.Sprintf("%dm", durationMin)
+	}
+	return fmt.Sprintf("%dh %02dm", durationMin/60, durationMin%60)
+}
+
+// Bare ages get a plus, anything else (e.g. "B/O") is kept as it is.
+func formatAgeRating(ageRating string) string {
+	if _, err := strconv.Atoi(ageRating); err == nil {
+		return ageRating + "+"
+	}
+	return ageRating
+}
+
+func loadMovieMetadata(title string, dbPtr *sql.DB) movieMetadata {
+	sqlSelect := `
+		SELECT year, duration, rating, director, poster_url, age_rating, kind
+			FROM movies
+			WHERE title = ?;
+	`
+	var year, duration sql.NullInt64
+	var rating sql.NullFloat64
+	var director, posterUrl, ageRating, kind sql.NullString
+	err := dbPtr.QueryRow(sqlSelect, title).
+		Scan(&year, &duration, &rating, &director, &posterUrl, &ageRating, &kind)
+	if err == sql.ErrNoRows {
+		return movieMetadata{}
+	} else if err != nil {
+		panic(err)
+	}
+
+	return movieMetadata{
+		year:        int(year.Int64),
+		genres:      loadMovieValues("movie_genres", "genre", title, dbPtr),
+		countries:   loadMovieValues("movie_countries", "country", title, dbPtr),
+		director:    director.String,
+		durationMin: int(duration.Int64),
+		rating:      rating.Float64,
+		posterUrl:   posterUrl.String,
+		ageRating:   ageRating.String,
+		kind:        kind.String,
+	}
+}
+
+func loadMovieValues(table string, column string, title string, dbPtr *sql.DB) []string {
+	sqlSelect := fmt.Sprintf(`
+		SELECT %s
+			FROM %s
+			WHERE title = ?
+			ORDER BY position;
+	`, column, table)
+	rows, err := dbPtr.Query(sqlSelect, title)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			panic(err)
+		}
+		values = append(values, value)
+	}
+
+	return values
+}
+
+func storeMovieMetadata(title string, metadata movieMetadata, dbPtr *sql.DB) {
+	sqlUpdate := `
+		UPDATE movies
+			SET year = ?, duration = ?, rating = ?, director = ?, poster_url = ?,
+				age_rating = ?, kind = ?
+			WHERE title = ?;
+	`
+	_, err := dbPtr.Exec(sqlUpdate,
+		nullIfZero(metadata.year), nullIfZero(metadata.durationMin),
+		nullIfZero(metadata.rating), nullIfZero(metadata.director),
+		nullIfZero(metadata.posterUrl), nullIfZero(metadata.ageRating),
+		nullIfZero(metadata.kind), title)
+	if err != nil {
+		panic(err)
+	}
+
+	storeMovieValues("movie_genres", "genre", title, metadata.genres, dbPtr)
+	storeMovieValues("movie_countries", "country", title, metadata.countries, dbPtr)
+}
+
+func storeMovieValues(table string, column string, title string, values []string, dbPtr *sql.DB) {
+	_, err := dbPtr.Exec(fmt.Sprintf(`DELETE FROM %s WHERE title = ?;`, table), title)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlInsert := fmt.Sprintf(`
+		INSERT OR IGNORE INTO %s
+			(title, %s, position)
+			VALUES(?, ?, ?);
+	`, table, column)
+	for position, value := range values {
+		_, err := dbPtr.Exec(sqlInsert, title, value, position)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func nullIfZero[T comparable](value T) any {
+	var zero T
+	if value == zero {
+		return nil
+	}
+	return value
+}
+
+// Metadata used to be taken from unsure matches as well, so it's cleared for
+// the movies which only have those. Whatever the cinemas give is filled in
+// again on the next run.
+func forgetUnsureMetadata(tx *sql.Tx) error {
+	unsureOnly := `
+		title IN (SELECT title FROM movie_ext_ids)
+		AND title NOT IN (
+			SELECT title
+				FROM movie_ext_ids
+				WHERE confidence IS NULL OR confidence >= ?
+		)
+	`
+
+	sqlUpdate := `
+		UPDATE movies
+			SET secondary_title = NULL, year = NULL, duration = NULL, rating = NULL,
+				director = NULL, poster_url = NULL, kind = NULL
+			WHERE ` + unsureOnly + `;
+	`
+	if _, err := tx.Exec(sqlUpdate, minMatchConfidence); err != nil {
+		return err
+	}
+
+	for _, table := range []string{"movie_genres", "movie_countries"} {
+		sqlDelete := fmt.Sprintf(`DELETE FROM %s WHERE %s;`, table, unsureOnly)
+		if _, err := tx.Exec(sqlDelete, minMatchConfidence); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"cmp"
+	"container/heap"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// for the films whose length isn't known from any of the sources
+const assumedDurationMin = 120
+
+// between the films of a double feature or a marathon
+const marathonBreakMin = 15
+
+type plannedShowing struct {
+	title   string
+	showing showing
+	end     time.Time
+	// 0 if it isn't known, and for a marathon that of its films with the
+	// breaks, partly assumed unless all of theirs are known
+	durationMin int
+	// when the length is just assumed
+	durationKnown bool
+	rating        float64
+	watched       bool
+}
+
+type planSequence struct {
+	showings     []plannedShowing
+	watchedCount int
+	// of the ratings in tenths, as they're shown, so that the sums are exact
+	ratingTenths int
+	ratedCount   int
+	// in which it was found, so that the equally good ones keep that order
+	order int
+}
+
+// what the sequences are ranked by
+type planScore struct {
+	watchedCount int
+	ratingTenths int
+	length       int
+}
+
+// the best sequences found so far, with the worst of them on top
+type sequenceHeap []planSequence
+
+// Proposes the best sequences of showings of different films on a given
+// day, out of the ones from the latest run, which don't overlap and leave
+// enough time to get between the cinemas.
+func planCommand(args []string) int {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	dateFlagPtr := flags.String("date", time.Now().Format(time.DateOnly), "The day to plan, e.g. 2026-10-24.")
+	fromFlagPtr := flags.String("from", "00:00", "The earliest start of the first showing, e.g. 17:00.")
+	cinemasFlagPtr := flags.String("cinemas", "", "IDs or names of the cinemas to go to, comma separated, all of them if not given.")
+	travelFlagPtr := flags.Int("travel", 30, "Minutes needed to get from one cinema to another.")
+	topFlagPtr := flags.Int("top", 5, "How many of the best sequences to propose.")
+	cityFlagPtr := flags.String("city", defaultCity, "ID of the city from the cinema registry to plan in.")
+	registryFlagPtr := flags.String("cinemas-config", "", "Path to the cinema registry, replacing the built-in one.")
+	adOffsetsFlagPtr := flags.String("ad-offsets", defaultAdOffsets, "Minutes of ads before the film by the cinema's source.")
+	flags.Parse(args)
+
+	if err := setupCinemas(*registryFlagPtr, "", *cityFlagPtr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := setAdOffsets(*adOffsetsFlagPtr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *topFlagPtr < 1 {
+		fmt.Fprintf(os.Stderr, "invalid number of sequences %d\n", *topFlagPtr)
+		return 2
+	}
+
+	date, err := time.ParseInLocation(time.DateOnly, *dateFlagPtr, warsawLocation)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid date %q\n", *dateFlagPtr)
+		return 2
+	}
+	fromMin, err := parseMinuteOfDay(*fromFlagPtr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	from := date.Add(time.Duration(max(fromMin, 0)) * time.Minute)
+
+	cinemas := enabledCinemas()
+	if *cinemasFlagPtr != "" {
+		cinemaInfos := []cinemaInfo{}
+		for _, cinema := range cinemas {
+			cinemaInfos = append(cinemaInfos, cinema.info())
+		}
+		cinemas = []cinema{}
+		for name := range strings.SplitSeq(*cinemasFlagPtr, ",") {
+			info, err := findCinemaByName(cinemaInfos, name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+			cinemas = append(cinemas, info.Id)
+		}
+	}
+
+	dbPtr := openDb("./movies.db")
+	defer dbPtr.Close()
+
+	watchlist := loadWatchlist(dbPtr)
+	plannedShowings := []plannedShowing{}
+	for title, showings := range loadPreviousShowings(dbPtr) {
+		movieInfoPtr := &movieInfo{
+			extIds:   loadExtIds(title, dbPtr),
+			metadata: loadMovieMetadata(title, dbPtr),
+		}
+		watched := slices.ContainsFunc(watchlist, func(entry watchEntry) bool {
+			return entry.matches(title, movieInfoPtr)
+		})
+
+		for _, showing := range showings {
+			if showing.time.Before(from) || !sameDay(showing.time, date) ||
+				!slices.Contains(cinemas, showing.cinema) {
+				continue
+			}
+
+			durationMin := movieInfoPtr.metadata.durationMin
+			plannedShowings = append(plannedShowings, plannedShowing{
+				title:         title,
+				showing:       showing,
+				durationMin:   durationMin,
+				durationKnown: durationMin > 0,
+				rating:        movieInfoPtr.metadata.rating,
+				watched:       watched,
+			})
+		}
+	}
+
+	plannedShowings = mergeCombinedShowings(plannedShowings)
+	for i, planned := range plannedShowings {
+		plannedShowings[i].end = planned.showing.estimatedEnd(cmp.Or(planned.durationMin, assumedDurationMin))
+	}
+	slices.SortFunc(plannedShowings, func(a, b plannedShowing) int {
+		return a.showing.time.Compare(b.showing.time)
+	})
+
+	sequences := findSequences(plannedShowings, time.Duration(*travelFlagPtr)*time.Minute, *topFlagPtr)
+	if len(sequences) == 0 {
+		fmt.Fprintf(os.Stderr, "no showings on %s from %s, is there a run with them yet?\n",
+			*dateFlagPtr, *fromFlagPtr)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, sequence := range sequences {
+		fmt.Fprintf(w, "#%d\t%s\n", i+1, sequence)
+		for _, planned := range sequence.showings {
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\n", planned.timeRange(), planned.showing.cinema,
+				planned.label(), planned.showing.url)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+
+	return 0
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+// Marathons' showings are listed under their films as well, and the showing
+// of the whole marathon is the one to keep. Unless its own length is known,
+// it lasts as long as its films together, with the breaks between them.
+func mergeCombinedShowings(plannedShowings []plannedShowing) []plannedShowing {
+	combinedKeys := map[showingKey]bool{}
+	for _, planned := range plannedShowings {
+		if planned.showing.combinedTitle == "" {
+			combinedKeys[planned.showing.key(planned.title)] = true
+		}
+	}
+
+	keyToComponents := map[showingKey][]plannedShowing{}
+	merged := []plannedShowing{}
+	for _, planned := range plannedShowings {
+		if planned.showing.combinedTitle != "" {
+			key := planned.showing.key(planned.showing.combinedTitle)
+			// it's the film's own showing if the marathon's isn't there
+			if combinedKeys[key] {
+				keyToComponents[key] = append(keyToComponents[key], planned)
+				continue
+			}
+		}
+		merged = append(merged, planned)
+	}
+
+	for i, planned := range merged {
+		components := keyToComponents[planned.showing.key(planned.title)]
+		if len(components) == 0 || planned.durationMin > 0 {
+			continue
+		}
+
+		merged[i].durationMin = (len(components) - 1) * marathonBreakMin
+		merged[i].durationKnown = true
+		for _, component := range components {
+			merged[i].durationMin += cmp.Or(component.durationMin, assumedDurationMin)
+			merged[i].durationKnown = merged[i].durationKnown && component.durationKnown
+		}
+	}
+	return merged
+}
+
+// The top sequences out of every one which can't be extended any further,
+// best first: the ones with the most films from the watchlist, then the best
+// rated ones overall, so that a good film isn't skipped for a better rated
+// average. The showings are expected to be sorted by their start. Branches
+// which can't beat the worst of the top ones found so far are cut short,
+// including the ones which could only tie with it, as they'd be found later.
+func findSequences(plannedShowings []plannedShowing, travel time.Duration, top int) []planSequence {
+	best := &sequenceHeap{}
+	found := 0
+	chainBounds := chainScores(plannedShowings, travel)
+
+	var extend func(sequence []plannedShowing, next int)
+	extend = func(sequence []plannedShowing, next int) {
+		if best.Len() == top &&
+			scoreBound(sequence, plannedShowings, next, chainBounds, travel).compare((*best)[0].score()) >= 0 {
+			return
+		}
+
+		extended := false
+		for i := next; i < len(plannedShowings); i++ {
+			candidate := plannedShowings[i]
+			if len(sequence) > 0 && !canFollow(sequence[len(sequence)-1], candidate, travel) {
+				continue
+			}
+			if hasTitle(sequence, candidate.title) {
+				continue
+			}
+
+			extended = true
+			extend(append(slices.Clip(sequence), candidate), i+1)
+		}
+
+		// the ones that skipped a showing which would've fit in are left out
+		if extended || len(sequence) == 0 || canFitMore(sequence, plannedShowings, travel) {
+			return
+		}
+
+		candidate := newPlanSequence(sequence)
+		candidate.order = found
+		found++
+		if best.Len() < top {
+			heap.Push(best, candidate)
+		} else if candidate.compare((*best)[0]) < 0 {
+			(*best)[0] = candidate
+			heap.Fix(best, 0)
+		}
+	}
+	extend(nil, 0)
+
+	sequences := []planSequence(*best)
+	slices.SortFunc(sequences, planSequence.compare)
+	return sequences
+}
+
+// The best score any sequence extending this one with the showings from
+// the next one on could get: the lower of the score as if all of their
+// other films which start late enough could still be fitted in, and the
+// best chain of them, even if it repeats films.
+func scoreBound(sequence []plannedShowing, plannedShowings []plannedShowing, next int, chainBounds []planScore, travel time.Duration) planScore {
+	titlesBound := planScore{}
+	chainBound := planScore{}
+	titles := map[string]bool{}
+	for i := next; i < len(plannedShowings); i++ {
+		candidate := plannedShowings[i]
+		if len(sequence) > 0 && !canFollow(sequence[len(sequence)-1], candidate, travel) {
+			continue
+		}
+
+		if chainBounds[i].compare(chainBound) < 0 {
+			chainBound = chainBounds[i]
+		}
+
+		if titles[candidate.title] || hasTitle(sequence, candidate.title) {
+			continue
+		}
+		titles[candidate.title] = true
+		titlesBound = titlesBound.add(candidate.score())
+	}
+
+	bound := newPlanSequence(sequence).score()
+	if titlesBound.compare(chainBound) > 0 {
+		return bound.add(titlesBound)
+	}
+	return bound.add(chainBound)
+}
+
+// For each of the showings (sorted by their start), the best score of a
+// chain of showings starting with it, not minding the films repeating.
+func chainScores(plannedShowings []plannedShowing, travel time.Duration) []planScore {
+	scores := make([]planScore, len(plannedShowings))
+	for i := len(plannedShowings) - 1; i >= 0; i-- {
+		bestNext := planScore{}
+		for j := i + 1; j < len(plannedShowings); j++ {
+			if canFollow(plannedShowings[i], plannedShowings[j], travel) && scores[j].compare(bestNext) < 0 {
+				bestNext = scores[j]
+			}
+		}
+		scores[i] = plannedShowings[i].score().add(bestNext)
+	}
+	return scores
+}
+
+// Whether the next one starts after the previous one's over, with the time
+// to get there if it's at another cinema.
+func canFollow(previous plannedShowing, next plannedShowing, travel time.Duration) bool {
+	ready := previous.end
+	if previous.showing.cinema != next.showing.cinema {
+		ready = ready.Add(travel)
+	}
+	return !next.showing.time.Before(ready)
+}
+
+func hasTitle(sequence []plannedShowing, title string) bool {
+	return slices.ContainsFunc(sequence, func(planned plannedShowing) bool {
+		return planned.title == title
+	})
+}
+
+// Whether any of the showings fits before, between or after the sequence's.
+func canFitMore(sequence []plannedShowing, plannedShowings []plannedShowing, travel time.Duration) bool {
+	return slices.ContainsFunc(plannedShowings, func(candidate plannedShowing) bool {
+		if hasTitle(sequence, candidate.title) {
+			return false
+		}
+		for i := 0; i <= len(sequence); i++ {
+			if (i == 0 || canFollow(sequence[i-1], candidate, travel)) &&
+				(i == len(sequence) || canFollow(candidate, sequence[i], travel)) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func newPlanSequence(showings []plannedShowing) planSequence {
+	sequence := planSequence{showings: showings}
+	for _, planned := range showings {
+		if planned.watched {
+			sequence.watchedCount++
+		}
+		if planned.rating > 0 {
+			sequence.ratingTenths += int(math.Round(planned.rating * 10))
+			sequence.ratedCount++
+		}
+	}
+	return sequence
+}
+
+func (s planSequence) score() planScore {
+	return planScore{s.watchedCount, s.ratingTenths, len(s.showings)}
+}
+
+// as a sequence of its own
+func (p plannedShowing) score() planScore {
+	return newPlanSequence([]plannedShowing{p}).score()
+}
+
+func (s planScore) add(other planScore) planScore {
+	return planScore{
+		watchedCount: s.watchedCount + other.watchedCount,
+		ratingTenths: s.ratingTenths + other.ratingTenths,
+		length:       s.length + other.length,
+	}
+}
+
+// Negative if the sequence ranks before the other one.
+func (s planSequence) compare(other planSequence) int {
+	return cmp.Or(s.score().compare(other.score()), cmp.Compare(s.order, other.order))
+}
+
+// Negative if the score ranks before the other one.
+func (s planScore) compare(other planScore) int {
+	return cmp.Or(
+		cmp.Compare(other.watchedCount, s.watchedCount),
+		cmp.Compare(other.ratingTenths, s.ratingTenths),
+		cmp.Compare(other.length, s.length),
+	)
+}
+
+func (h sequenceHeap) Len() int           { return len(h) }
+func (h sequenceHeap) Less(i, j int) bool { return h[i].compare(h[j]) > 0 }
+func (h sequenceHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *sequenceHeap) Push(x any) {
+	*h = append(*h, x.(planSequence))
+}
+
+func (h *sequenceHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+func (s planSequence) averageRating() float64 {
+	if s.ratedCount == 0 {
+		return 0
+	}
+	return float64(s.ratingTenths) / 10 / float64(s.ratedCount)
+}
+
+// e.g. "3 films, 1 on the watchlist, ★7.4 on average"
+func (s planSequence) String() string {
+	parts := []string{fmt.Sprintf("%d films", len(s.showings))}
+	if len(s.showings) == 1 {
+		parts[0] = "1 film"
+	}
+	if s.watchedCount > 0 {
+		parts = append(parts, fmt.Sprintf("%d on the watchlist", s.watchedCount))
+	}
+	if s.ratedCount > 0 {
+		parts = append(parts, fmt.Sprintf("★%.1f on average", s.averageRating()))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// e.g. "17:30-19:45", with a '~' for an assumed end
+func (p plannedShowing) timeRange() string {
+	approximate := ""
+	if !p.durationKnown {
+		approximate = "~"
+	}
+	return fmt.Sprintf("%s-%s%s", p.showing.time.Format("15:04"), approximate, p.end.Format("15:04"))
+}
+
+func (p plannedShowing) label() string {
+	label := p.title
+	if p.rating > 0 {
+		label += fmt.Sprintf(" ★%.1f", p.rating)
+	}
+	if p.watched {
+		label += " (on the watchlist)"
+	}
+	return label
+}
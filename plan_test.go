@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Every sequence which can't be extended any further, in the order they're
+// found in, ranked without cutting any branches short.
+func allSequences(plannedShowings []plannedShowing, travel time.Duration) []planSequence {
+	sequences := []planSequence{}
+
+	var extend func(sequence []plannedShowing, next int)
+	extend = func(sequence []plannedShowing, next int) {
+		extended := false
+		for i := next; i < len(plannedShowings); i++ {
+			candidate := plannedShowings[i]
+			if len(sequence) > 0 && !canFollow(sequence[len(sequence)-1], candidate, travel) ||
+				hasTitle(sequence, candidate.title) {
+				continue
+			}
+			extended = true
+			extend(append(slices.Clip(sequence), candidate), i+1)
+		}
+
+		if !extended && len(sequence) > 0 && !canFitMore(sequence, plannedShowings, travel) {
+			sequence := newPlanSequence(sequence)
+			sequence.order = len(sequences)
+			sequences = append(sequences, sequence)
+		}
+	}
+	extend(nil, 0)
+
+	slices.SortStableFunc(sequences, func(a, b planSequence) int {
+		return a.score().compare(b.score())
+	})
+	return sequences
+}
+
+func randomPlannedShowings(random *rand.Rand, count int) []plannedShowing {
+	cinemas := []cinema{"Kijow", "Mikro", "Agrafka", "Paradox"}
+	titleCount := count / 3
+
+	titleRatings := []float64{}
+	titleWatched := []bool{}
+	titleDurations := []int{}
+	for range titleCount {
+		rating := 0.0
+		if random.IntN(4) > 0 {
+			rating = float64(50+random.IntN(40)) / 10
+		}
+		titleRatings = append(titleRatings, rating)
+		titleWatched = append(titleWatched, random.IntN(5) == 0)
+		titleDurations = append(titleDurations, 80+random.IntN(100))
+	}
+
+	plannedShowings := []plannedShowing{}
+	for range count {
+		titleIndex := random.IntN(titleCount)
+		start := time.Date(2026, time.October, 24, 10, 15*random.IntN(52), 0, 0, warsawLocation)
+		plannedShowings = append(plannedShowings, plannedShowing{
+			title:         fmt.Sprintf("FILM %d", titleIndex),
+			showing:       showing{cinema: cinemas[random.IntN(len(cinemas))], time: start},
+			end:           start.Add(time.Duration(titleDurations[titleIndex]) * time.Minute),
+			durationKnown: true,
+			rating:        titleRatings[titleIndex],
+			watched:       titleWatched[titleIndex],
+		})
+	}
+
+	slices.SortFunc(plannedShowings, func(a, b plannedShowing) int {
+		return a.showing.time.Compare(b.showing.time)
+	})
+	return plannedShowings
+}
+
+func TestFindSequencesIsExact(t *testing.T) {
+	travel := 30 * time.Minute
+
+	for seed := range uint64(20) {
+		random := rand.New(rand.NewPCG(seed, 0))
+		plannedShowings := randomPlannedShowings(random, 24)
+		// so that many of the sequences tie
+		if seed%4 == 0 {
+			unrate(plannedShowings)
+		}
+		want := allSequences(plannedShowings, travel)
+
+		for _, top := range []int{1, 5, 50} {
+			got := findSequences(plannedShowings, travel, top)
+			if len(got) != min(top, len(want)) {
+				t.Fatalf("seed %d, top %d: %d sequences, want %d", seed, top, len(got), min(top, len(want)))
+			}
+			for i := range got {
+				if !slices.EqualFunc(got[i].showings, want[i].showings, func(a, b plannedShowing) bool {
+					return a.title == b.title && a.showing.time.Equal(b.showing.time)
+				}) {
+					t.Errorf("seed %d, top %d: #%d is %s (%s), want %s (%s)", seed, top, i+1,
+						got[i], titlesOf(got[i]), want[i], titlesOf(want[i]))
+				}
+			}
+		}
+	}
+}
+
+// Too many to check against every sequence, but with all of them tying it
+// has to cut the branches which can only tie as well to finish at all.
+func TestFindSequencesUnrated(t *testing.T) {
+	random := rand.New(rand.NewPCG(0, 0))
+	plannedShowings := randomPlannedShowings(random, 200)
+	unrate(plannedShowings)
+
+	got := findSequences(plannedShowings, 30*time.Minute, 5)
+	if len(got) != 5 {
+		t.Fatalf("%d sequences, want 5", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].compare(got[i-1]) < 0 {
+			t.Errorf("#%d (%s) ranks before #%d (%s)", i+1, got[i], i, got[i-1])
+		}
+	}
+}
+
+func TestFindSequencesRanking(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2026, time.October, 24, hour, 0, 0, 0, warsawLocation)
+	}
+	planned := func(title string, cinema cinema, hour int, rating float64, watched bool) plannedShowing {
+		return plannedShowing{
+			title:   title,
+			showing: showing{cinema: cinema, time: at(hour)},
+			end:     at(hour + 2),
+			rating:  rating,
+			watched: watched,
+		}
+	}
+
+	// the watchlist comes first, even with fewer and worse rated films
+	plannedShowings := []plannedShowing{
+		planned("ŚREDNI", "Kijow", 16, 6.0, false),
+		planned("DOBRY", "Kijow", 17, 8.0, false),
+		planned("Z LISTY", "Mikro", 18, 5.0, true),
+		planned("NIEZŁY", "Kijow", 19, 7.0, false),
+		planned("ŚWIETNY", "Kijow", 21, 9.0, false),
+	}
+	got := findSequences(plannedShowings, 30*time.Minute, 3)
+
+	want := [][]string{
+		{"Z LISTY", "ŚWIETNY"},
+		{"DOBRY", "NIEZŁY", "ŚWIETNY"},
+		{"ŚREDNI", "NIEZŁY", "ŚWIETNY"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%d sequences, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if titles := titlesOf(got[i]); !slices.Equal(titles, want[i]) {
+			t.Errorf("#%d is %v, want %v", i+1, titles, want[i])
+		}
+	}
+}
+
+func TestMergeCombinedShowings(t *testing.T) {
+	at := func(cinema cinema, hour int) showing {
+		return showing{
+			cinema: cinema,
+			time:   time.Date(2026, time.October, 24, hour, 0, 0, 0, warsawLocation),
+			url:    fmt.Sprintf("https://kupbilet.example.pl/%d", hour),
+		}
+	}
+	planned := func(title string, hour int, durationMin int) plannedShowing {
+		return plannedShowing{title: title, showing: at("Kijow", hour), durationMin: durationMin, durationKnown: durationMin > 0}
+	}
+	component := func(title string, combinedTitle string, hour int, durationMin int) plannedShowing {
+		planned := planned(title, hour, durationMin)
+		planned.showing.combinedTitle = combinedTitle
+		return planned
+	}
+	// unrelated films that start together at a multiplex
+	atBonarka := func(title string, durationMin int) plannedShowing {
+		planned := planned(title, 20, durationMin)
+		planned.showing.cinema = "CCityBonarka"
+		return planned
+	}
+
+	plannedShowings := []plannedShowing{
+		planned("OBCY", 12, 117),
+		planned("OBCY", 18, 117),
+		// a double feature of known films, with another film starting with it
+		planned("OBCY OBCY DECYDUJĄCE STARCIE", 18, 0),
+		component("OBCY", "OBCY OBCY DECYDUJĄCE STARCIE", 18, 117),
+		component("OBCY DECYDUJĄCE STARCIE", "OBCY OBCY DECYDUJĄCE STARCIE", 18, 137),
+		atBonarka("DIUNA", 155),
+		atBonarka("OBCY", 117),
+		atBonarka("COŚ", 0),
+		// a marathon with a film whose length isn't known
+		component("NOSFERATU", "MARATON GROZY", 21, 94),
+		planned("MARATON GROZY", 21, 0),
+		component("COŚ", "MARATON GROZY", 21, 0),
+		component("OBCY", "MARATON GROZY", 21, 117),
+		// a marathon whose own length is given by the cinema
+		planned("MARATON NOCNY", 23, 330),
+		component("DIUNA", "MARATON NOCNY", 23, 155),
+		component("DIUNA CZĘŚĆ DRUGA", "MARATON NOCNY", 23, 166),
+		// a film of a marathon which isn't among the showings
+		component("OSTATNI SEANS", "MARATON PORANNY", 9, 118),
+	}
+
+	want := []plannedShowing{
+		planned("OBCY", 12, 117),
+		planned("OBCY", 18, 117),
+		{
+			title:         "OBCY OBCY DECYDUJĄCE STARCIE",
+			showing:       at("Kijow", 18),
+			durationMin:   117 + marathonBreakMin + 137,
+			durationKnown: true,
+		},
+		atBonarka("DIUNA", 155),
+		atBonarka("OBCY", 117),
+		atBonarka("COŚ", 0),
+		{
+			title:       "MARATON GROZY",
+			showing:     at("Kijow", 21),
+			durationMin: 94 + marathonBreakMin + assumedDurationMin + marathonBreakMin + 117,
+		},
+		planned("MARATON NOCNY", 23, 330),
+		planned("OSTATNI SEANS", 9, 118),
+	}
+
+	got := mergeCombinedShowings(plannedShowings)
+	if len(got) != len(want) {
+		t.Fatalf("%d showings, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].title != want[i].title || got[i].showing.cinema != want[i].showing.cinema ||
+			!got[i].showing.time.Equal(want[i].showing.time) ||
+			got[i].durationMin != want[i].durationMin || got[i].durationKnown != want[i].durationKnown {
+			t.Errorf("#%d is %s at %s %s, %d minutes (known: %v), want %s at %s %s, %d minutes (known: %v)", i+1,
+				got[i].title, got[i].showing.cinema, got[i].showing.time.Format("15:04"),
+				got[i].durationMin, got[i].durationKnown,
+				want[i].title, want[i].showing.cinema, want[i].showing.time.Format("15:04"),
+				want[i].durationMin, want[i].durationKnown)
+		}
+	}
+}
+
+func unrate(plannedShowings []plannedShowing) {
+	for i := range plannedShowings {
+		plannedShowings[i].rating = 0
+		plannedShowings[i].watched = false
+	}
+}
+
+func titlesOf(sequence planSequence) []string {
+	titles := []string{}
+	for _, planned := range sequence.showings {
+		titles = append(titles, planned.title)
+	}
+	return titles
+}
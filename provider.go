@@ -0,0 +1,231 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// An external movie db used for linking titles and obtaining their metadata.
+type metadataProvider interface {
+	name() string
+	// A nil match without an error means there was nothing even remotely
+	// resembling the title.
+	lookup(title string, year int, client *http.Client) (*metadataMatch, error)
+	movieUrl(extId string) string
+}
+
+type metadataMatch struct {
+	provider       string
+	extId          string
+	secondaryTitle string
+	confidence     float64
+	metadata       movieMetadata
+}
+
+type extId struct {
+	id string
+	// NULL for filmweb matches from before confidence was tracked
+	confidence sql.NullFloat64
+}
+
+// only this many search hits get scored (which for some providers means
+// an extra request each)
+const maxMatchCandidates = 5
+
+// matches scoring below this are stored, but not linked in the summary
+const minMatchConfidence = 0.7
+
+// in order of preference, set up in main
+var metadataProviders []metadataProvider
+
+func newMetadataProviders(namesStr string, tmdbApi string, tmdbToken string) []metadataProvider {
+	providers := []metadataProvider{}
+
+	for _, name := range strings.Split(namesStr, ",") {
+		switch strings.TrimSpace(name) {
+		case "filmweb":
+			providers = append(providers, filmwebProvider{})
+		case "tmdb":
+			if tmdbToken == "" {
+				log.Println("tmdb needs a token, skipping it")
+				continue
+			}
+			providers = append(providers, tmdbProvider{apiUrl: tmdbApi, token: tmdbToken})
+		case "":
+		default:
+			log.Printf("unknown metadata provider %q, skipping it\n", name)
+		}
+	}
+
+	return providers
+}
+
+func (e extId) isConfident() bool {
+	// matches from before confidence was tracked are trusted
+	return !e.confidence.Valid || e.confidence.Float64 >= minMatchConfidence
+}
+
+// Link to the movie in the most preferred provider that confidently matched
+// it, none for a movie that isn't known.
+func movieLink(movieInfoPtr *movieInfo) string {
+	if movieInfoPtr == nil {
+		return ""
+	}
+
+	for _, provider := range metadataProviders {
+		extId, ok := movieInfoPtr.extIds[provider.name()]
+		if ok && extId.isConfident() {
+			return provider.movieUrl(extId.id)
+		}
+	}
+
+	return ""
+}
+
+// Providers which have never been asked about the title, or only before
+// the current matching and metadata were in place. The ones less preferred
+// than a provider which already matched it confidently aren't needed.
+func providersToLookup(movieInfoPtr *movieInfo) []metadataProvider {
+	providers := []metadataProvider{}
+	for _, provider := range metadataProviders {
+		extId, ok := movieInfoPtr.extIds[provider.name()]
+		if !ok || !extId.confidence.Valid {
+			providers = append(providers, provider)
+		} else if extId.isConfident() {
+			break
+		}
+	}
+
+	return providers
+}
+
+func loadExtIds(title string, dbPtr *sql.DB) map[string]extId {
+	sqlSelect := `
+		SELECT provider, ext_id, confidence
+			FROM movie_ext_ids
+			WHERE title = ?;
+	`
+	rows, err := dbPtr.Query(sqlSelect, title)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	extIds := map[string]extId{}
+	for rows.Next() {
+		var provider string
+		var e extId
+		if err := rows.Scan(&provider, &e.id, &e.confidence); err != nil {
+			panic(err)
+		}
+		extIds[provider] = e
+	}
+
+	return extIds
+}
+
+func storeExtId(title string, match *metadataMatch, dbPtr *sql.DB) {
+	sqlUpsert := `
+		INSERT INTO movie_ext_ids
+			(title, provider, ext_id, confidence)
+			VALUES(?, ?, ?, ?)
+			ON CONFLICT(title, provider) DO UPDATE
+				SET ext_id = excluded.ext_id, confidence = excluded.confidence;
+	`
+	_, err := dbPtr.Exec(sqlUpsert, title, match.provider, match.extId, match.confidence)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Weighted sum in the range [0, 1] of how well the candidate's titles match
+// the repertoire title, whether its release year agrees with the one given by
+// the cinema (if any), how recent it is (most screenings are new releases,
+// but retro screenings shouldn't be ruled out) and whether it's a film at all.
+func scoreCandidate(title string, year int, candidateTitles []string, candidateYear int, isFilm bool) float64 {
+	similarity := 0.0
+	for _, candidateTitle := range candidateTitles {
+		if candidateTitle != "" {
+			similarity = max(similarity, titleSimilarity(title, candidateTitle))
+		}
+	}
+
+	yearScore := 0.5
+	if year != 0 && candidateYear != 0 {
+		switch yearDiff := abs(year - candidateYear); yearDiff {
+		case 0:
+			yearScore = 1
+		case 1:
+			yearScore = 0.5
+		default:
+			yearScore = 0
+		}
+	}
+
+	recencyScore := 0.0
+	if candidateYear != 0 {
+		age := time.Now().Year() - candidateYear
+		recencyScore = math.Max(0, math.Min(1, 1-float64(age-1)/20))
+	}
+
+	typeScore := 0.0
+	if isFilm {
+		typeScore = 1
+	}
+
+	return 0.6*similarity + 0.2*yearScore + 0.1*recencyScore + 0.1*typeScore
+}
+
+// 1 for identical titles (ignoring case, punctuation and spacing),
+// falling towards 0 with their edit distance.
+func titleSimilarity(a string, b string) float64 {
+	aRunes := []rune(simplifyTitle(a))
+	bRunes := []rune(simplifyTitle(b))
+
+	maxLen := max(len(aRunes), len(bRunes))
+	if maxLen == 0 {
+		return 0
+	}
+
+	return 1 - float64(levenshtein(aRunes, bRunes))/float64(maxLen)
+}
+
+func simplifyTitle(title string) string {
+	title = strings.ToUpper(title)
+	title = allPunctuationRegex.ReplaceAllString(title, " ")
+	title = multipleSpacesRegex.ReplaceAllString(title, " ")
+	return strings.TrimSpace(title)
+}
+
+func levenshtein(a []rune, b []rune) int {
+	prevRow := make([]int, len(b)+1)
+	row := make([]int, len(b)+1)
+	for j := range prevRow {
+		prevRow[j] = j
+	}
+
+	for i := range a {
+		row[0] = i + 1
+		for j := range b {
+			substitutionCost := 1
+			if a[i] == b[j] {
+				substitutionCost = 0
+			}
+			row[j+1] = min(prevRow[j+1]+1, row[j]+1, prevRow[j]+substitutionCost)
+		}
+		prevRow, row = row, prevRow
+	}
+
+	return prevRow[len(b)]
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
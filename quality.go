@@ -0,0 +1,184 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type anomalyKind int
+
+const (
+	MissingUrl anomalyKind = iota
+	UnparsableDate
+	ImplausibleDate
+	EmptyTitle
+	ShowingCountDrop
+	UnexpectedResponse
+)
+
+var anomalyDescriptions = map[anomalyKind]string{
+	MissingUrl:         "showings without a booking URL",
+	UnparsableDate:     "unparsable dates",
+	ImplausibleDate:    "implausible dates",
+	EmptyTitle:         "titles empty after normalization",
+	ShowingCountDrop:   "far fewer showings than last run",
+	UnexpectedResponse: "unexpected API responses",
+}
+
+type anomaly struct {
+	cinema cinema
+	kind   anomalyKind
+	detail string
+}
+
+// showings further ahead than this are most likely misparsed
+const maxShowingAdvance = 400 * 24 * time.Hour
+
+// a cinema dropping below this fraction of its previous showing count
+// (if it had enough of them for it to mean anything) is suspicious
+const (
+	minShowingCountRatio = 0.5
+	minComparedShowings  = 10
+)
+
+// Checks the aggregated showings along with the per cinema showing counts
+// against the previous run's. Anomalies found earlier during scraping and
+// normalization are expected to already be in the given slice.
+func checkDataQuality(titleToShowings map[string][]showing, cinemaToCount map[cinema]int, anomalies []anomaly, dbPtr *sql.DB) []anomaly {
+	now := time.Now()
+
+	for title, showings := range titleToShowings {
+		for _, showing := range showings {
+			if showing.url == "" {
+				anomalies = append(anomalies, anomaly{showing.cinema, MissingUrl,
+					fmt.Sprintf("%s at %s", title, showing.time.Format(time.DateTime))})
+			}
+
+			if showing.time.IsZero() || showing.time.Sub(now) > maxShowingAdvance {
+				anomalies = append(anomalies, anomaly{showing.cinema, ImplausibleDate,
+					fmt.Sprintf("%s at %s", title, showing.time.Format(time.DateTime))})
+			}
+		}
+	}
+
+	previousCounts := loadPreviousShowingCounts(dbPtr)
+	for cinema, count := range cinemaToCount {
+		previousCount, ok := previousCounts[string(cinema)]
+		if !ok || previousCount < minComparedShowings {
+			continue
+		}
+
+		if float64(count) < minShowingCountRatio*float64(previousCount) {
+			anomalies = append(anomalies, anomaly{cinema, ShowingCountDrop,
+				fmt.Sprintf("%d showings, down from %d", count, previousCount)})
+		}
+	}
+
+	return anomalies
+}
+
+func loadPreviousShowingCounts(dbPtr *sql.DB) map[string]int {
+	sqlSelect := `
+		SELECT cinema, showings
+			FROM run_cinema_counts
+			WHERE run_id = (SELECT MAX(id) FROM runs WHERE city = ?);
+	`
+	rows, err := dbPtr.Query(sqlSelect, currentCity.Id)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	cinemaToCount := map[string]int{}
+	for rows.Next() {
+		var cinema string
+		var count int
+		if err := rows.Scan(&cinema, &count); err != nil {
+			panic(err)
+		}
+		cinemaToCount[cinema] = count
+	}
+
+	return cinemaToCount
+}
+
+func recordRun(cinemaToCount map[cinema]int, anomalies []anomaly, dbPtr *sql.DB) int64 {
+	res, err := dbPtr.Exec(`INSERT INTO runs (started_at, city) VALUES(?, ?);`,
+		time.Now().Format(time.RFC3339), currentCity.Id)
+	if err != nil {
+		panic(err)
+	}
+	runId, err := res.LastInsertId()
+	if err != nil {
+		panic(err)
+	}
+
+	for cinema, count := range cinemaToCount {
+		sqlInsert := `
+			INSERT INTO run_cinema_counts
+				(run_id, cinema, showings)
+				VALUES(?, ?, ?);
+		`
+		_, err := dbPtr.Exec(sqlInsert, runId, string(cinema), count)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for _, anomaly := range anomalies {
+		sqlInsert := `
+			INSERT INTO run_anomalies
+				(run_id, cinema, kind, detail)
+				VALUES(?, ?, ?, ?);
+		`
+		_, err := dbPtr.Exec(sqlInsert, runId, string(anomaly.cinema),
+			anomalyDescriptions[anomaly.kind], anomaly.detail)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	return runId
+}
+
+// One line per cinema and kind of anomaly, the details are only in the db.
+func writeWarnings(sb *strings.Builder, anomalies []anomaly) {
+	type cinemaKind struct {
+		cinema cinema
+		kind   anomalyKind
+	}
+
+	counts := map[cinemaKind]int{}
+	details := map[cinemaKind]string{}
+	for _, anomaly := range anomalies {
+		key := cinemaKind{anomaly.cinema, anomaly.kind}
+		counts[key]++
+		details[key] = anomaly.detail
+	}
+
+	keys := make([]cinemaKind, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b cinemaKind) int {
+		if a.cinema != b.cinema {
+			return cmp.Compare(a.cinema, b.cinema)
+		}
+		return int(a.kind) - int(b.kind)
+	})
+
+	for _, key := range keys {
+		var warningLine string
+		if key.kind == ShowingCountDrop {
+			warningLine = fmt.Sprintf(`%s: %s  \n`, key.cinema, details[key])
+		} else {
+			warningLine = fmt.Sprintf(`%s: %d %s  \n`,
+				key.cinema, counts[key], anomalyDescriptions[key.kind])
+		}
+		sb.WriteString(warningLine)
+	}
+}
@@ -1,60 +1,118 @@
 package main
 
 import (
+	_ "embed"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gocolly/colly"
 )
 
+// Used unless another definitions file is given with --scrapers.
+//
+//go:embed scrapers.json
+var defaultScrapeSitesJson []byte
+
+// Describes how to find the showings on a cinema's repertoire page(s), so
+// that most cinemas can be added without writing any Go.
 type scrapeSite struct {
-	cinema      cinema
-	rootSel     string
-	nextPageSel string
-	charSet     string
+	CinemaName    string `json:"cinema"`
+	RepertoireUrl string `json:"repertoireUrl"`
+	RootSel       string `json:"rootSelector"`
+	NextPageSel   string `json:"nextPageSelector"`
+	CharSet       string `json:"charset"`
+	DateOrder     string `json:"dateOrder"`
+
+	Title fieldSpec `json:"title"`
+	// the time is appended to the date, so either can hold both
+	Date fieldSpec `json:"date"`
+	Time fieldSpec `json:"time"`
+	Url  fieldSpec `json:"url"`
+
+	// parts of the titles of the cinema's own series of events, e.g.
+	// "Opera w kinie", matched regardless of case
+	EventMarkers []string `json:"eventMarkers"`
+
+	cinema    cinema
+	dateOrder dateOrder
 }
 
-var repertoires = map[cinema]string{
-	Agrafka:     "https://bilety.kinoagrafka.pl/",
-	Kijow:       "https://kupbilet.kijow.pl/MSI/mvc/pl?sort=Date&date=1970-01&datestart=0/",
-	Kika:        "https://bilety.kinokika.pl/",
-	Mikro:       "https://kinomikro.pl/repertoire/?view=all/",
-	Paradox:     "https://kinoparadox.pl/repertuar/",
-	PodBaranami: "https://kinopodbaranami.pl/repertuar.php/",
-	Sfinks:      "https://kinosfinks.okn.edu.pl/wydarzenia-szukaj-strona-1.html", //can't have a slash at the end of the url for some reason
+// How to extract a single value from a showing's root element.
+type fieldSpec struct {
+	// relative to the root element, the root element itself if empty
+	Selector string `json:"selector"`
+	// which of the selector's matches to use, all of them if unset
+	Index *int `json:"index"`
+	// read instead of the text, from the first match
+	Attr string `json:"attr"`
+	// keep only this many of the last lines
+	LastLines int `json:"lastLines"`
+	// keep only the first capture group
+	Regex string `json:"regex"`
+	// e.g. "https://example.com/%s", for relative URLs and such; any other
+	// '%' (e.g. in an escaped query) is kept as it is
+	Template string `json:"template"`
+	// elements without it take it from the previous element instead
+	Sticky bool `json:"sticky"`
+	// elements without it aren't showings at all, rather than broken ones
+	Optional bool `json:"optional"`
+
+	regex *regexp.Regexp
 }
 
-var ticketBases = map[cinema]string{
-	Agrafka: "https://bilety.kinoagrafka.pl/",
-	Kijow:   "https://kupbilet.kijow.pl/",
-	Kika:    "https://bilety.kinokika.pl/",
-	Mikro:   "https://kinomikro.pl/",
-	Paradox: "https://kinoparadox.pl/repertuar/",
-	PodBaranami: "https://rezerwacja.kinopodbaranami.pl/Rezerwacja/default.aspx?event_id=%s" +
-		"&typetran=0&returnlink=http://kinopodbaranami.pl/rezerwacja_koniec.php&" +
-		"buylink=http://kinopodbaranami.pl/rezerwacja_koniec.php/",
-	Sfinks: "https://kinosfinks.okn.edu.pl/",
+var dateOrderNames = map[string]dateOrder{
+	"day-month-year": DayMonthYear,
+	"year-month-day": YearMonthDay,
 }
 
-var cinemasToScrape = [...]scrapeSite{
-	{cinema: Agrafka,
-		rootSel: "div.repertoire-once"},
-	{cinema: Kijow,
-		rootSel:     "div.cd-timeline-block",
-		nextPageSel: "a[href].eventcard.col-6"},
-	{cinema: Kika,
-		rootSel: "div.repertoire-once"},
-	{cinema: Paradox,
-		rootSel: "div.list-item__content__row"},
-	{cinema: Mikro,
-		rootSel: "section.row"},
-	{cinema: PodBaranami,
-		rootSel: "li[title]",
-		charSet: "iso-8859-2"},
-	{cinema: Sfinks,
-		rootSel:     "span.zajawka",
-		nextPageSel: "a[href][title^='Strona']"},
+// for elements which aren't showings, rather than ones failing to parse
+var errSkipShowing = errors.New("not a showing")
+
+// the enabled ones, set up by setupCinemas
+var cinemasToScrape []scrapeSite
+
+func parseScrapeSites(sitesJson []byte) ([]scrapeSite, error) {
+	var sites []scrapeSite
+	if err := json.Unmarshal(sitesJson, &sites); err != nil {
+		return nil, err
+	}
+
+	for i := range sites {
+		site := &sites[i]
+		site.cinema = cinema(site.CinemaName)
+
+		var ok bool
+		if site.dateOrder, ok = dateOrderNames[site.DateOrder]; !ok {
+			return nil, fmt.Errorf("%s: unknown date order %q", site.CinemaName, site.DateOrder)
+		}
+
+		if site.RootSel == "" || site.Title.Selector == "" && site.Title.Attr == "" {
+			return nil, fmt.Errorf("%s: root and title selectors are required", site.CinemaName)
+		}
+
+		for _, field := range []*fieldSpec{&site.Title, &site.Date, &site.Time, &site.Url} {
+			if field.Template != "" && strings.Count(field.Template, "%s") != 1 {
+				return nil, fmt.Errorf("%s: template %q needs exactly one %%s", site.CinemaName, field.Template)
+			}
+			if field.Regex == "" {
+				continue
+			}
+			regex, err := regexp.Compile(field.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", site.CinemaName, err)
+			}
+			field.regex = regex
+		}
+	}
+
+	return sites, nil
 }
 
 func scrape(resultCh chan result) {
@@ -66,187 +124,173 @@ func scrape(resultCh chan result) {
 func scrapeCinema(site scrapeSite, resultCh chan result) {
 	cinema := site.cinema
 
-	c := colly.NewCollector(
-		colly.MaxDepth(2),
-		colly.Async(true),
-	)
-
-	c.OnRequest(func(r *colly.Request) {
-		if site.charSet != "" {
-			r.ResponseCharacterEncoding = site.charSet
-		}
-	})
-
 	titleToShowings := make(map[string][]showing)
+	anomalies := []anomaly{}
+	// pages of async collectors may get processed concurrently
+	var resultMu sync.Mutex
 
-	var lastDate string
-	c.OnHTML(site.rootSel, func(e *colly.HTMLElement) {
-		title := getTitle(cinema, e)
-		if title == "" {
+	stickyValues := map[*fieldSpec]string{}
+	err := visitSite(site, func(e *colly.HTMLElement) {
+		resultMu.Lock()
+		defer resultMu.Unlock()
+
+		title, dateTime, url, err := extractShowing(&site, e, stickyValues)
+		if errors.Is(err, errSkipShowing) {
+			return
+		} else if err != nil {
+			anomalies = append(anomalies,
+				anomaly{cinema, UnparsableDate, fmt.Sprintf("%s: %s", title, err)})
 			return
 		}
 
-		dateTime := getDateTime(cinema, e, &lastDate)
-
-		url := getShowingUrl(cinema, e)
-
 		if !dateTime.Before(time.Now().Local()) {
-			titleToShowings[title] = append(titleToShowings[title], showing{cinema, dateTime, url})
+			scraped := showing{cinema: cinema, time: dateTime, url: url}
+			if site.isEventTitle(title) {
+				scraped.categories = []eventCategory{Event}
+			}
+			titleToShowings[title] = append(titleToShowings[title], scraped)
 		}
 	})
-
-	if site.nextPageSel != "" {
-		c.OnHTML(site.nextPageSel, func(e *colly.HTMLElement) {
-			link := getNextNextPageUrl(cinema, e)
-			c.Visit(link)
-		})
+	if err != nil {
+		log.Println(cinema, err)
 	}
 
-	c.Visit(repertoires[cinema])
-	c.Wait()
-
-	resultCh <- result{cinema: cinema, titleToShowings: titleToShowings}
+	resultCh <- result{cinema: cinema, titleToShowings: titleToShowings, anomalies: anomalies}
 }
 
-func getTitle(cinema cinema, e *colly.HTMLElement) string {
-	var title string
+func (site *scrapeSite) isEventTitle(title string) bool {
+	upperTitle := strings.ToUpper(title)
+	return slices.ContainsFunc(site.EventMarkers, func(marker string) bool {
+		return strings.Contains(upperTitle, strings.ToUpper(marker))
+	})
+}
 
-	switch cinema {
-	case Agrafka, Kika:
-		title = e.DOM.Find("a").First().Text()
+// Calls onElement for every match of the site's root selector across all of
+// its pages, returning the first failed request's error, if any.
+func visitSite(site scrapeSite, onElement func(e *colly.HTMLElement)) error {
+	c := colly.NewCollector(
+		colly.MaxDepth(2),
+		colly.Async(true),
+	)
 
-	case Kijow:
-		title = e.DOM.Find("h2").After("i").Text()
+	c.OnRequest(func(r *colly.Request) {
+		if site.CharSet != "" {
+			r.ResponseCharacterEncoding = site.CharSet
+		}
+	})
 
-	case Mikro:
-		title = e.DOM.Find("a.repertoire-item-title").Text()
+	var visitErr error
+	var errMu sync.Mutex
+	c.OnError(func(r *colly.Response, err error) {
+		errMu.Lock()
+		defer errMu.Unlock()
+		if visitErr == nil {
+			visitErr = err
+		}
+	})
 
-	case Paradox:
-		title = e.DOM.Find("a.item-title").Text()
+	c.OnHTML(site.RootSel, onElement)
 
-	case PodBaranami:
-		title = e.DOM.Find("a").First().Text()
-		// lots of newlines and garbage around it
-		title = strings.TrimSpace(title)
+	if site.NextPageSel != "" {
+		c.OnHTML(site.NextPageSel, func(e *colly.HTMLElement) {
+			link := e.Request.AbsoluteURL(e.Attr("href"))
+			c.Visit(link)
+		})
+	}
 
-	case Sfinks:
-		title = e.DOM.Find("span.title").Text()
+	if err := c.Visit(site.RepertoireUrl); err != nil {
+		return err
 	}
+	c.Wait()
 
-	return title
+	return visitErr
 }
 
-func getDateTime(cinema cinema, e *colly.HTMLElement, lastDate *string) time.Time {
-	var dateTimeStr string
-
-	switch cinema {
-	case Agrafka, Kika:
-		dateRaw := e.DOM.Find("div.date").Text()
-		dateLines := strings.Split(dateRaw, "\n")
-		dateLines = dateLines[len(dateLines)-2:]
-		dateTimeStr = strings.Join(dateLines, "")
-
-	case Kijow:
-		dateTimeStr = e.DOM.Find("span.cd-date").Text()
-
-	case Mikro:
-		dateElementMaybe := e.DOM.Find("div.repertoire-separator")
-		if dateElementMaybe.Length() != 0 {
-			*lastDate = dateElementMaybe.Text()
+// Returns errSkipShowing for elements without a title or an optional date,
+// which is how sites tend to mark things which aren't bookable showings.
+// Sticky values are carried over between calls in the given map, so the
+// elements have to be passed in document order.
+func extractShowing(site *scrapeSite, e *colly.HTMLElement, stickyValues map[*fieldSpec]string) (string, time.Time, string, error) {
+	extract := func(field *fieldSpec) (string, bool) {
+		value, found := field.extract(e)
+		if field.Sticky {
+			if found {
+				stickyValues[field] = value
+			} else {
+				value, found = stickyValues[field]
+			}
 		}
-		dateRaw := *lastDate
-		timeRaw := e.DOM.Find("p.repertoire-item-hour").Text()
-		dateTimeStr = dateRaw + " " + timeRaw
-
-	case Paradox:
-		dateRaw, _ := e.DOM.Attr("data-date")
-		timeRaw := e.DOM.Find("div.item-time").Text()
-		dateTimeStr = dateRaw + " " + timeRaw
-
-	case PodBaranami:
-		timeRaw := e.DOM.Find("span").Find("a").Text()
-		onclickStr, found := e.DOM.Find("span").Find("a").Attr("onclick")
-		// times without URLs can just be skipped over
-		if !found {
-			return time.Time{}
-		}
-
-		onClickWords := strings.Split(onclickStr, ",")
-		dateRaw := onClickWords[len(onClickWords)-5]
-		dateTimeStr = dateRaw + " " + timeRaw
-
-	case Sfinks:
-		dateTimeElement := e.DOM.Find("span.kali_data_od")
-		dateRaw := dateTimeElement.Find("span").First().Text()
-		timeRaw := dateTimeElement.Find("span").Eq(2).Text()
-		dateTimeStr = dateRaw + " " + timeRaw
+		return value, found
 	}
 
-	return processDateTimeString(dateTimeStr, cinema)
-}
-
-func getShowingUrl(cinema cinema, e *colly.HTMLElement) string {
-	var url string
-	var exists bool
+	title, found := extract(&site.Title)
+	if !found || title == "" {
+		return "", time.Time{}, "", errSkipShowing
+	}
 
-	switch cinema {
-	case Agrafka:
-		url, exists = e.DOM.Find("a.button").Attr("href")
-		if exists {
-			url = ticketBases[Agrafka] + url
-		}
+	dateStr, found := extract(&site.Date)
+	if !found && site.Date.Optional {
+		return title, time.Time{}, "", errSkipShowing
+	}
+	timeStr, _ := extract(&site.Time)
 
-	case Kika:
-		url, exists = e.DOM.Find("a.button").Attr("href")
-		if exists {
-			url = ticketBases[Kika] + url
-		}
+	dateTime, err := parseShowingTime(dateStr+" "+timeStr, site.dateOrder)
+	if err != nil {
+		return title, time.Time{}, "", err
+	}
 
-	case Kijow:
-		url, exists = e.DOM.Find("a.btn-badge2").Attr("href")
-		if exists {
-			url = ticketBases[Kijow] + url
-		}
+	url, _ := extract(&site.Url)
 
-	case Mikro:
-		url, exists = e.DOM.Find("a.repertoire-item-button").Attr("href")
-		if exists {
-			url = ticketBases[Mikro] + url
-		}
+	return title, dateTime, url, nil
+}
 
-	case Paradox:
-		url, exists = e.DOM.Find("a.btn").Attr("href")
+func (field *fieldSpec) extract(e *colly.HTMLElement) (string, bool) {
+	if field.Selector == "" && field.Attr == "" {
+		return "", false
+	}
 
-	case PodBaranami:
-		// completely busted urls, need to work around them
-		url, exists = e.DOM.Find("a[onclick]").Attr("href")
-		if exists {
-			urlParts := strings.Split(url, "=")
-			showingId := urlParts[len(urlParts)-1]
-			url = fmt.Sprintf(ticketBases[PodBaranami], showingId)
+	selection := e.DOM
+	if field.Selector != "" {
+		selection = e.DOM.Find(field.Selector)
+		if field.Index != nil {
+			selection = selection.Eq(*field.Index)
 		}
+	}
+	if selection.Length() == 0 {
+		return "", false
+	}
 
-	case Sfinks:
-		url, exists = e.DOM.Find("a").Attr("href")
-		if exists {
-			url = ticketBases[Sfinks] + url
+	var value string
+	if field.Attr != "" {
+		var exists bool
+		value, exists = selection.Attr(field.Attr)
+		if !exists {
+			return "", false
 		}
+	} else {
+		value = selection.Text()
 	}
 
-	if !exists {
-		return ""
+	if field.LastLines > 0 {
+		lines := strings.Split(value, "\n")
+		lines = lines[max(0, len(lines)-field.LastLines):]
+		value = strings.Join(lines, " ")
 	}
 
-	return url
-}
+	// lots of newlines and garbage around some of them
+	value = strings.TrimSpace(value)
 
-func getNextNextPageUrl(cinema cinema, e *colly.HTMLElement) string {
-	var url string
+	if field.regex != nil {
+		match := field.regex.FindStringSubmatch(value)
+		if len(match) < 2 {
+			return "", false
+		}
+		value = match[1]
+	}
 
-	switch cinema {
-	case Kijow, Sfinks:
-		url = e.Request.AbsoluteURL(e.Attr("href"))
+	if field.Template != "" {
+		value = strings.Replace(field.Template, "%s", value, 1)
 	}
 
-	return url
+	return value, true
 }
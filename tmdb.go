@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Can be pointed at any API compatible with TMDB's v3 one, e.g. a local
+// stand-in, using the --tmdb-api flag.
+const tmdbDefaultApi = "https://api.themoviedb.org/3"
+
+var tmdbUrls = map[string]string{
+	"MovieStart":  "https://www.themoviedb.org/movie/",
+	"PosterStart": "https://image.tmdb.org/t/p/w342",
+}
+
+const tmdbLanguage = "pl-PL"
+
+type tmdbProvider struct {
+	apiUrl string
+	token  string
+}
+
+func (tmdbProvider) name() string {
+	return "tmdb"
+}
+
+func (tmdbProvider) movieUrl(extId string) string {
+	return tmdbUrls["MovieStart"] + extId
+}
+
+func (p tmdbProvider) lookup(title string, year int, client *http.Client) (*metadataMatch, error) {
+	query := url.Values{}
+	query.Set("query", title)
+	query.Set("language", tmdbLanguage)
+
+	var body map[string]any
+	if err := p.get("/search/movie?"+query.Encode(), client, &body); err != nil {
+		return nil, err
+	}
+
+	results, ok := body["results"].([]any)
+	if !ok {
+		return nil, fmt.Errorf("tmdb search for %q has no results list", title)
+	}
+
+	var best map[string]any
+	bestScore := 0.0
+	for i, e := range results {
+		if i == maxMatchCandidates {
+			break
+		}
+
+		result, _ := e.(map[string]any)
+		resultTitle, _ := result["title"].(string)
+		originalTitle, _ := result["original_title"].(string)
+		releaseDate, _ := result["release_date"].(string)
+
+		score := scoreCandidate(title, year,
+			[]string{resultTitle, originalTitle}, tmdbReleaseYear(releaseDate), true)
+		if best == nil || score > bestScore {
+			best = result
+			bestScore = score
+		}
+	}
+
+	if best == nil {
+		return nil, nil
+	}
+
+	idRaw, ok := best["id"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("tmdb search hit for %q has no id", title)
+	}
+	id := strconv.Itoa(int(idRaw))
+
+	var details map[string]any
+	detailsPath := fmt.Sprintf("/movie/%s?language=%s&append_to_response=credits", id, tmdbLanguage)
+	if err := p.get(detailsPath, client, &details); err != nil {
+		return nil, err
+	}
+
+	detailsTitle, _ := details["title"].(string)
+	originalTitle, _ := details["original_title"].(string)
+	secondaryTitle := ""
+	if originalTitle != detailsTitle {
+		secondaryTitle = originalTitle
+	}
+
+	return &metadataMatch{
+		provider:       "tmdb",
+		extId:          id,
+		secondaryTitle: secondaryTitle,
+		confidence:     bestScore,
+		metadata:       parseTmdbMetadata(details),
+	}, nil
+}
+
+func (p tmdbProvider) get(path string, client *http.Client, body *map[string]any) error {
+	req, _ := http.NewRequest("GET", p.apiUrl+path, nil)
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("tmdb %s: %s", path, res.Status)
+	}
+
+	bodyBytes, _ := io.ReadAll(res.Body)
+	return json.Unmarshal(bodyBytes, body)
+}
+
+func parseTmdbMetadata(details map[string]any) movieMetadata {
+	var metadata movieMetadata
+
+	releaseDate, _ := details["release_date"].(string)
+	metadata.year = tmdbReleaseYear(releaseDate)
+
+	if runtime, ok := details["runtime"].(float64); ok {
+		metadata.durationMin = int(runtime)
+	}
+
+	if voteAverage, ok := details["vote_average"].(float64); ok {
+		metadata.rating = voteAverage
+	}
+
+	genresRaw, _ := details["genres"].([]any)
+	for _, e := range genresRaw {
+		genreMap, _ := e.(map[string]any)
+		if name, ok := genreMap["name"].(string); ok {
+			metadata.genres = append(metadata.genres, name)
+		}
+	}
+
+	countriesRaw, _ := details["production_countries"].([]any)
+	for _, e := range countriesRaw {
+		countryMap, _ := e.(map[string]any)
+		if code, ok := countryMap["iso_3166_1"].(string); ok {
+			metadata.countries = append(metadata.countries, code)
+		}
+	}
+
+	credits, _ := details["credits"].(map[string]any)
+	crew, _ := credits["crew"].([]any)
+	for _, e := range crew {
+		crewMap, _ := e.(map[string]any)
+		if job, _ := crewMap["job"].(string); job == "Director" {
+			metadata.director, _ = crewMap["name"].(string)
+			break
+		}
+	}
+
+	if posterPath, ok := details["poster_path"].(string); ok {
+		metadata.posterUrl = tmdbUrls["PosterStart"] + posterPath
+	}
+
+	return metadata
+}
+
+// from "YYYY-MM-DD", 0 if missing
+func tmdbReleaseYear(releaseDate string) int {
+	if len(releaseDate) < 4 {
+		return 0
+	}
+	year, _ := strconv.Atoi(releaseDate[:4])
+	return year
+}
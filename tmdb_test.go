@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// Stands in for the parts of TMDB's API the provider uses.
+func newTmdbStandIn(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search/movie", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("language") != tmdbLanguage {
+			t.Errorf("search language = %q, want %q", r.URL.Query().Get("language"), tmdbLanguage)
+		}
+
+		switch r.URL.Query().Get("query") {
+		case "DIUNA CZĘŚĆ DRUGA", "ZUPEŁNIE INNY TYTUŁ":
+			w.Write([]byte(`{"results": [
+				{"id": 438631, "title": "Diuna", "original_title": "Dune", "release_date": "2021-09-15"},
+				{"id": 693134, "title": "Diuna: Część druga", "original_title": "Dune: Part Two", "release_date": "2024-02-27"}
+			]}`))
+		case "BŁĄD":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "BEZ LISTY":
+			w.Write([]byte(`{"total_results": 0}`))
+		default:
+			w.Write([]byte(`{"results": []}`))
+		}
+	})
+	mux.HandleFunc("/movie/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("id") {
+		case "693134":
+			w.Write([]byte(`{
+				"title": "Diuna: Część druga",
+				"original_title": "Dune: Part Two",
+				"release_date": "2024-02-27",
+				"runtime": 167,
+				"vote_average": 8.1,
+				"genres": [{"id": 878, "name": "Sci-Fi"}, {"id": 12, "name": "Przygodowy"}],
+				"production_countries": [{"iso_3166_1": "US", "name": "United States of America"}],
+				"poster_path": "/diuna.jpg",
+				"credits": {"crew": [
+					{"job": "Producer", "name": "Mary Parent"},
+					{"job": "Director", "name": "Denis Villeneuve"}
+				]}
+			}`))
+		case "438631":
+			w.Write([]byte(`{"title": "Diuna", "original_title": "Dune", "release_date": "2021-09-15"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTmdbLookup(t *testing.T) {
+	server := newTmdbStandIn(t)
+	provider := tmdbProvider{apiUrl: server.URL, token: "token"}
+
+	match, err := provider.lookup("DIUNA CZĘŚĆ DRUGA", 2024, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match == nil {
+		t.Fatal("no match")
+	}
+	if match.provider != "tmdb" || match.extId != "693134" {
+		t.Errorf("matched %s %s, want tmdb 693134", match.provider, match.extId)
+	}
+	if match.confidence < minMatchConfidence {
+		t.Errorf("confidence = %.2f, want at least %.2f", match.confidence, minMatchConfidence)
+	}
+	if match.secondaryTitle != "Dune: Part Two" {
+		t.Errorf("secondary title = %q, want %q", match.secondaryTitle, "Dune: Part Two")
+	}
+
+	metadata := match.metadata
+	if metadata.year != 2024 || metadata.durationMin != 167 || metadata.rating != 8.1 ||
+		metadata.director != "Denis Villeneuve" ||
+		metadata.posterUrl != tmdbUrls["PosterStart"]+"/diuna.jpg" ||
+		!slices.Equal(metadata.genres, []string{"Sci-Fi", "Przygodowy"}) ||
+		!slices.Equal(metadata.countries, []string{"US"}) {
+		t.Errorf("metadata = %+v", metadata)
+	}
+}
+
+func TestTmdbLookupUnsure(t *testing.T) {
+	server := newTmdbStandIn(t)
+	provider := tmdbProvider{apiUrl: server.URL, token: "token"}
+
+	match, err := provider.lookup("ZUPEŁNIE INNY TYTUŁ", 0, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match == nil {
+		t.Fatal("no match")
+	}
+	if match.confidence >= minMatchConfidence {
+		t.Errorf("confidence = %.2f, want below %.2f", match.confidence, minMatchConfidence)
+	}
+}
+
+func TestTmdbLookupFailures(t *testing.T) {
+	server := newTmdbStandIn(t)
+
+	tests := []struct {
+		title   string
+		token   string
+		wantErr bool
+	}{
+		{"NIEZNANY", "token", false},
+		{"BŁĄD", "token", true},
+		{"BEZ LISTY", "token", true},
+		{"DIUNA CZĘŚĆ DRUGA", "zły", true},
+	}
+
+	for _, test := range tests {
+		provider := tmdbProvider{apiUrl: server.URL, token: test.token}
+		match, err := provider.lookup(test.title, 0, server.Client())
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want an error: %v", test.title, err, test.wantErr)
+		}
+		if match != nil {
+			t.Errorf("%s: matched %s", test.title, match.extId)
+		}
+	}
+}
+
+func TestScoreCandidate(t *testing.T) {
+	exact := scoreCandidate("DIUNA", 2021, []string{"Diuna", "Dune"}, 2021, true)
+	if exact < minMatchConfidence {
+		t.Errorf("exact match scored %.2f, want at least %.2f", exact, minMatchConfidence)
+	}
+
+	// e.g. a remake, or a different film with the same title
+	otherYear := scoreCandidate("DIUNA", 2021, []string{"Diuna"}, 1984, true)
+	if otherYear >= exact {
+		t.Errorf("match from another year scored %.2f, no less than the exact one's %.2f", otherYear, exact)
+	}
+
+	notFilm := scoreCandidate("DIUNA", 2021, []string{"Diuna"}, 2021, false)
+	if notFilm >= exact {
+		t.Errorf("match which isn't a film scored %.2f, no less than the exact one's %.2f", notFilm, exact)
+	}
+
+	// the original title counts as much as the translated one
+	original := scoreCandidate("DUNE", 2021, []string{"Diuna", "Dune"}, 2021, true)
+	if original != exact {
+		t.Errorf("original title match scored %.2f, want %.2f", original, exact)
+	}
+
+	different := scoreCandidate("ZUPEŁNIE INNY TYTUŁ", 0, []string{"Diuna", "Dune"}, 2021, true)
+	if different >= minMatchConfidence {
+		t.Errorf("different title scored %.2f, want below %.2f", different, minMatchConfidence)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Gotify's scale goes up to 10, with 8 and above being the urgent ones.
+const watchAlertPriority = 8
+
+const lastChanceReason = "last chance"
+
+const watchUsage = "usage: kino watch add|remove|list|import [title, Filmweb URL or ID | watchlist ID | file]"
+
+// e.g. "https://www.filmweb.pl/film/Diuna-2021-1234567" or just "1234567"
+var filmwebIdArgRegex = regexp.MustCompile(`^(?:https?://(?:www\.)?filmweb\.pl/(?:film|serial)/.*-)?(\d+)/?$`)
+
+type watchEntry struct {
+	id int64
+	// with a Filmweb ID, the title is only a label (if it's set at all)
+	title     string
+	filmwebId string
+	addedAt   time.Time
+}
+
+type watchAlert struct {
+	title        string
+	movieInfoPtr *movieInfo
+	reason       string
+}
+
+// Manages the watchlist in the db, whose movies get their own notifications.
+func watchCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, watchUsage)
+		return 2
+	}
+	subcommand := args[0]
+
+	flags := flag.NewFlagSet("watch "+subcommand, flag.ExitOnError)
+	flags.Parse(args[1:])
+	arg := strings.TrimSpace(strings.Join(flags.Args(), " "))
+
+	dbPtr := openDb("./movies.db")
+	defer dbPtr.Close()
+
+	switch subcommand {
+	case "add":
+		if arg == "" {
+			fmt.Fprintln(os.Stderr, watchUsage)
+			return 2
+		}
+		entry := newWatchEntry(arg)
+		addWatchEntry(entry, dbPtr)
+		fmt.Printf("watching %s\n", entry)
+
+	case "remove":
+		if arg == "" {
+			fmt.Fprintln(os.Stderr, watchUsage)
+			return 2
+		}
+		if removed := removeWatchEntry(arg, dbPtr); removed == 0 {
+			fmt.Fprintf(os.Stderr, "%q isn't on the watchlist\n", arg)
+			return 1
+		}
+		fmt.Printf("stopped watching %s\n", arg)
+
+	case "import":
+		if arg == "" {
+			fmt.Fprintln(os.Stderr, watchUsage)
+			return 2
+		}
+		if err := importWatchlist(arg, dbPtr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tWATCHING\tADDED")
+		for _, entry := range loadWatchlist(dbPtr) {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", entry.id, entry, entry.addedAt.Format(time.DateOnly))
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprintln(os.Stderr, watchUsage)
+		return 2
+	}
+
+	return 0
+}
+
+func newWatchEntry(arg string) watchEntry {
+	if match := filmwebIdArgRegex.FindStringSubmatch(arg); match != nil {
+		return watchEntry{filmwebId: match[1]}
+	}
+	return watchEntry{title: arg}
+}
+
+func (e watchEntry) String() string {
+	if e.filmwebId == "" {
+		return e.title
+	} else if e.title == "" {
+		return "Filmweb ID " + e.filmwebId
+	}
+	return fmt.Sprintf("%s (Filmweb ID %s)", e.title, e.filmwebId)
+}
+
+// Watched by Filmweb ID if there's one, otherwise by the simplified title.
+func (e watchEntry) matches(title string, movieInfoPtr *movieInfo) bool {
+	if e.filmwebId != "" {
+		extId, ok := movieInfoPtr.extIds[filmwebProvider{}.name()]
+		return ok && filmwebNumericId(extId.id) == e.filmwebId
+	}
+	return simplifyTitle(e.title) == simplifyTitle(title)
+}
+
+func addWatchEntry(entry watchEntry, dbPtr *sql.DB) {
+	sqlInsert := `
+		INSERT INTO watchlist
+			(title, filmweb_id, added_at)
+			VALUES(?, ?, ?);
+	`
+	_, err := dbPtr.Exec(sqlInsert, nullIfZero(entry.title), nullIfZero(entry.filmwebId),
+		time.Now().Format(time.RFC3339))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// By its ID in the list, its (simplified) title or its Filmweb ID, returning
+// how many entries were removed.
+func removeWatchEntry(arg string, dbPtr *sql.DB) int {
+	id, _ := strconv.ParseInt(arg, 10, 64)
+	argEntry := newWatchEntry(arg)
+
+	removed := 0
+	for _, entry := range loadWatchlist(dbPtr) {
+		matches := entry.id == id ||
+			argEntry.filmwebId != "" && entry.filmwebId == argEntry.filmwebId ||
+			entry.title != "" && simplifyTitle(entry.title) == simplifyTitle(arg)
+		if !matches {
+			continue
+		}
+
+		_, err := dbPtr.Exec(`DELETE FROM watchlist WHERE id = ?;`, entry.id)
+		if err != nil {
+			panic(err)
+		}
+		removed++
+	}
+
+	return removed
+}
+
+func loadWatchlist(dbPtr *sql.DB) []watchEntry {
+	sqlSelect := `
+		SELECT id, title, filmweb_id, added_at
+			FROM watchlist
+			ORDER BY id;
+	`
+	rows, err := dbPtr.Query(sqlSelect)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	entries := []watchEntry{}
+	for rows.Next() {
+		var entry watchEntry
+		var title, filmwebId sql.NullString
+		var addedAtStr string
+		if err := rows.Scan(&entry.id, &title, &filmwebId, &addedAtStr); err != nil {
+			panic(err)
+		}
+		entry.title = title.String
+		entry.filmwebId = filmwebId.String
+		entry.addedAt, _ = time.Parse(time.RFC3339, addedAtStr)
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// Watched movies which appeared, got new showings or are about to leave,
+// at most one alert per movie, in that order of importance.
+func findWatchAlerts(watchlist []watchEntry, data summaryData) []watchAlert {
+	isWatched := func(title string, movieInfoPtr *movieInfo) bool {
+		for _, entry := range watchlist {
+			if entry.matches(title, movieInfoPtr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	titleToMovie := map[string]*movieInfo{}
+	for _, movieMap := range data.periodToMovie {
+		for title, movieInfoPtr := range movieMap {
+			titleToMovie[title] = movieInfoPtr
+		}
+	}
+	// the ones only showing in their own sections
+	for _, movieMap := range data.categoryToMovies {
+		for title, movieInfoPtr := range movieMap {
+			if _, ok := titleToMovie[title]; !ok {
+				titleToMovie[title] = movieInfoPtr
+			}
+		}
+	}
+
+	alerts := []watchAlert{}
+	for _, title := range sortedTitles(titleToMovie) {
+		movieInfoPtr := titleToMovie[title]
+		if !isWatched(title, movieInfoPtr) {
+			continue
+		}
+
+		addedCount := 0
+		for _, change := range data.titleToChanges[title] {
+			if change.kind == Added {
+				addedCount++
+			}
+		}
+
+		var reason string
+		if _, ok := data.periodToMovie[Today][title]; ok {
+			reason = "now showing"
+		} else if addedCount > 0 {
+			reason = fmt.Sprintf("%d new showings", addedCount)
+		} else if _, ok := data.lastChance[title]; ok {
+			reason = lastChanceReason
+		} else {
+			continue
+		}
+
+		alerts = append(alerts, watchAlert{title, movieInfoPtr, reason})
+	}
+
+	return alerts
+}
+
+// One line per movie, with its reason and its next showing.
+func createWatchAlertMessage(alerts []watchAlert) string {
+	var sb strings.Builder
+	for _, alert := range alerts {
+		alertLine := fmt.Sprintf(`%s  *%s*  \n`,
+			formatTitleLink(alert.title, alert.movieInfoPtr), alert.reason)
+		sb.WriteString(alertLine)
+
+		showings := alert.movieInfoPtr.showings
+		if alert.reason == lastChanceReason {
+			showings = showings[len(showings)-1:]
+		}
+		if len(showings) > 0 {
+			showing := showings[0]
+			showingLine := fmt.Sprintf(`[%s](%s) [%s](%s)  \n`,
+				showing.cinema, showing.cinema.info().Website,
+				formatShowingTime(showing.time), showing.url)
+			sb.WriteString(showingLine)
+		}
+	}
+	return sb.String()
+}